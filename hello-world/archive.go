@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3Uploader는 스트리밍 본문을 보내면서 S3에 올릴 때 쓰는 API입니다. (s3manager.Uploader)
+type S3Uploader interface {
+	UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
+}
+
+// bulkArchiver는 OpenSearch에 보낸 _bulk 본문을 감사용으로 S3에 그대로 남깁니다. (ARCHIVE_BULK_S3_PREFIX)
+type bulkArchiver struct {
+	client S3Putter
+	// BULK_STREAMING 본문을 파트 단위로 올리는 업로더. 본문 전체를 메모리에 모으지 않습니다.
+	uploader S3Uploader
+	bucket   string
+	prefix   string
+	// 압축하지 않고 보낸 본문도 gzip으로 저장할지 여부 (ARCHIVE_BULK_GZIP)
+	gzip bool
+	// 저장하지 못하면 배치를 실패시킬지 여부 (ARCHIVE_BULK_REQUIRED). 기본은 로그만 남깁니다.
+	required bool
+}
+
+// parseArchiveURI는 ARCHIVE_BULK_S3_PREFIX(s3://bucket/prefix)를 읽습니다.
+func parseArchiveURI(value string) (bucket, prefix string, err error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid ARCHIVE_BULK_S3_PREFIX %q (expected s3://bucket/prefix)", value)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+// newBulkArchiverFromEnv는 ARCHIVE_BULK_S3_PREFIX가 있으면 bulkArchiver를 만듭니다. 값이 없으면 nil을 반환합니다.
+func newBulkArchiverFromEnv(sess *session.Session) (*bulkArchiver, error) {
+	value := os.Getenv("ARCHIVE_BULK_S3_PREFIX")
+	if value == "" {
+		return nil, nil
+	}
+	bucket, prefix, err := parseArchiveURI(value)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.New(sess)
+	return &bulkArchiver{
+		client:   client,
+		uploader: s3manager.NewUploaderWithClient(client),
+		bucket:   bucket,
+		prefix:   prefix,
+		gzip:     envBool("ARCHIVE_BULK_GZIP", false),
+		required: envBool("ARCHIVE_BULK_REQUIRED", false),
+	}, nil
+}
+
+// archiveTarget은 배치 하나의 본문을 저장할 위치입니다. 워커가 배치마다 ctx에 넣습니다.
+type archiveTarget struct {
+	archiver *bulkArchiver
+	// 원본 객체와 파일 안에서 몇 번째 배치인지 (키에 들어감)
+	bucket string
+	key    string
+	batch  int
+	// 배치 안에서 보낸 요청 수 (MAX_BULK_BYTES나 413 때문에 여러 요청으로 나뉠 수 있음)
+	requests int32
+}
+
+type archiveContextKey struct{}
+
+// withArchiveTarget은 ctx에서 보내는 _bulk 본문을 target에 저장하게 합니다. archiver가 nil이면 ctx를 그대로 반환합니다.
+func withArchiveTarget(ctx context.Context, archiver *bulkArchiver, bucket, key string, batch int) context.Context {
+	if archiver == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, archiveContextKey{}, &archiveTarget{archiver: archiver, bucket: bucket, key: key, batch: batch})
+}
+
+func archiveTargetFrom(ctx context.Context) *archiveTarget {
+	target, _ := ctx.Value(archiveContextKey{}).(*archiveTarget)
+	return target
+}
+
+// objectKey는 요청 하나의 본문을 저장할 키를 만듭니다.
+// 예: <prefix>/feed-bucket/feeds/products.avro/batch-000003-000.ndjson.gz
+func (t *archiveTarget) objectKey(request int32, gzipped bool) string {
+	name := fmt.Sprintf("batch-%06d-%03d.ndjson", t.batch, request)
+	if gzipped {
+		name += ".gz"
+	}
+	return path.Join(t.archiver.prefix, t.bucket, t.key, name)
+}
+
+// put은 본문 하나를 저장합니다. gzipped는 body가 이미 gzip으로 압축되어 있는지 여부입니다.
+// 저장하지 못하면 로그를 남기고, ARCHIVE_BULK_REQUIRED일 때만 오류를 반환합니다.
+func (t *archiveTarget) put(ctx context.Context, body []byte, gzipped bool) error {
+	if !gzipped && t.archiver.gzip {
+		compressed, err := gzipBody(body)
+		if err != nil {
+			return t.failed(err, "")
+		}
+		body, gzipped = compressed, true
+	}
+	key := t.objectKey(atomic.AddInt32(&t.requests, 1)-1, gzipped)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(t.archiver.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body),
+		ContentType: aws.String(defaultBulkContentType),
+	}
+	if gzipped {
+		input.ContentEncoding = aws.String("gzip")
+	}
+	if _, err := t.archiver.client.PutObjectWithContext(ctx, input); err != nil {
+		return t.failed(err, key)
+	}
+	logger.Debug("archived bulk request", "bucket", t.archiver.bucket, "key", key, "bytes", len(body))
+	return nil
+}
+
+func (t *archiveTarget) failed(err error, key string) error {
+	logger.Error("failed to archive bulk request", "bucket", t.archiver.bucket, "key", key,
+		"source_bucket", t.bucket, "source_key", t.key, "required", t.archiver.required, "error", err)
+	if !t.archiver.required {
+		return nil
+	}
+	return &archiveError{bucket: t.archiver.bucket, key: key, err: err}
+}
+
+// archiveError는 ARCHIVE_BULK_REQUIRED일 때 본문을 저장하지 못했음을 나타냅니다.
+// 스트리밍 본문은 보낸 뒤에 저장하므로 bulkSender는 이 오류를 인코딩 오류와 구분해 색인 결과를 그대로 둡니다.
+type archiveError struct {
+	bucket string
+	key    string
+	err    error
+}
+
+func (e *archiveError) Error() string {
+	return fmt.Sprintf("error archiving bulk request to s3://%s/%s: %v", e.bucket, e.key, e.err)
+}
+
+func (e *archiveError) Unwrap() error { return e.err }
+
+// archive는 본문을 보내기 전에 저장합니다. 미리 만든 본문은 바로 저장하고,
+// 스트리밍 본문은 보내면서 같은 바이트를 S3 업로드로 흘려 보냅니다. target이 nil이면 payload를 그대로 반환합니다.
+func (t *archiveTarget) archive(ctx context.Context, payload bulkPayload, gzipped bool) (bulkPayload, error) {
+	if t == nil {
+		return payload, nil
+	}
+	if body, ok := payload.(bytesPayload); ok {
+		return payload, t.put(ctx, body, gzipped)
+	}
+	return &archivingPayload{next: payload, target: t, ctx: ctx, gzipped: gzipped}, nil
+}
+
+// archivingPayload는 스트리밍 본문을 보낼 때마다 업로드를 새로 시작하고 요청이 끝나면 마무리합니다.
+// 재시도할 때마다 본문을 다시 인코딩해 보내므로 시도마다 요청 번호를 새로 붙여 저장합니다.
+type archivingPayload struct {
+	next    bulkPayload
+	target  *archiveTarget
+	ctx     context.Context
+	gzipped bool
+}
+
+func (p *archivingPayload) open() (io.Reader, func() (int, error)) {
+	body, finish := p.next.open()
+	upload := p.target.upload(p.ctx, p.gzipped)
+	copied := &archiveCopy{r: body, w: upload.w}
+	return copied, func() (int, error) {
+		written, err := finish()
+		if err != nil {
+			upload.abort(err)
+			return written, err
+		}
+		if !copied.completed() {
+			// 요청이 본문을 끝까지 보내지 못하고 끝났으면 보낸 본문이 아니므로 업로드를 취소합니다.
+			logger.Debug("bulk request body was not sent completely, not archiving it",
+				"source_bucket", p.target.bucket, "source_key", p.target.key)
+			upload.abort(errIncompleteBody)
+			return written, nil
+		}
+		return written, upload.close()
+	}
+}
+
+// errIncompleteBody는 요청이 본문을 끝까지 보내지 못해 업로드를 취소할 때 씁니다.
+var errIncompleteBody = errors.New("bulk request body was not sent completely")
+
+// archiveUpload는 스트리밍 본문 하나를 S3에 올리는 중인 업로드입니다.
+// 본문은 파이프로 업로더에 넘어가므로 메모리에는 s3manager의 파트 버퍼만 남습니다.
+type archiveUpload struct {
+	target *archiveTarget
+	key    string
+	pw     *io.PipeWriter
+	// 본문을 쓰는 곳 (ARCHIVE_BULK_GZIP으로 압축하면 zw, 아니면 pw)
+	w    io.Writer
+	zw   *gzip.Writer
+	done chan struct{}
+	err  error
+}
+
+// upload는 요청 하나의 본문을 올리기 시작합니다. gzipped는 보내는 본문이 이미 gzip으로 압축되어 있는지 여부입니다.
+func (t *archiveTarget) upload(ctx context.Context, gzipped bool) *archiveUpload {
+	compress := !gzipped && t.archiver.gzip
+	pr, pw := io.Pipe()
+	u := &archiveUpload{
+		target: t,
+		key:    t.objectKey(atomic.AddInt32(&t.requests, 1)-1, gzipped || compress),
+		pw:     pw,
+		w:      pw,
+		done:   make(chan struct{}),
+	}
+	if compress {
+		u.zw = gzip.NewWriter(pw)
+		u.w = u.zw
+	}
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(t.archiver.bucket),
+		Key:         aws.String(u.key),
+		Body:        pr,
+		ContentType: aws.String(defaultBulkContentType),
+	}
+	if gzipped || compress {
+		input.ContentEncoding = aws.String("gzip")
+	}
+	go func() {
+		defer close(u.done)
+		_, u.err = t.archiver.uploader.UploadWithContext(ctx, input)
+		// 업로드가 먼저 끝나면(실패 등) 더 쓰지 못하게 해 본문을 보내는 쪽이 막히지 않게 합니다.
+		pr.Close()
+	}()
+	return u
+}
+
+// close는 본문을 다 쓰고 업로드가 끝나기를 기다립니다.
+// 저장하지 못하면 로그를 남기고, ARCHIVE_BULK_REQUIRED일 때만 오류를 반환합니다.
+func (u *archiveUpload) close() error {
+	var err error
+	if u.zw != nil {
+		err = u.zw.Close()
+	}
+	u.pw.CloseWithError(err)
+	<-u.done
+	if u.err != nil {
+		err = u.err
+	}
+	if err != nil {
+		return u.target.failed(err, u.key)
+	}
+	logger.Debug("archived bulk request", "bucket", u.target.archiver.bucket, "key", u.key)
+	return nil
+}
+
+// abort는 업로드를 취소하고 끝나기를 기다립니다. 업로더는 파이프 오류를 받아 객체를 만들지 않습니다.
+func (u *archiveUpload) abort(err error) {
+	u.pw.CloseWithError(err)
+	<-u.done
+}
+
+// archiveCopy는 HTTP 요청이 읽어 간 본문을 w(업로드)에 쓰고 끝까지 읽었는지 기록합니다.
+// 응답을 받은 뒤에도 전송 쪽이 본문을 읽고 있을 수 있으므로 잠금으로 보호합니다.
+type archiveCopy struct {
+	r io.Reader
+
+	mu sync.Mutex
+	// 업로드가 실패해 더 쓸 수 없으면 nil로 바꿉니다. 오류는 업로드를 마무리할 때 알립니다.
+	w        io.Writer
+	complete bool
+}
+
+func (c *archiveCopy) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.w != nil && n > 0 {
+		if _, writeErr := c.w.Write(p[:n]); writeErr != nil {
+			c.w = nil
+		}
+	}
+	if err == io.EOF {
+		c.complete = true
+	}
+	return n, err
+}
+
+func (c *archiveCopy) completed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.complete
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// UploadWithContext는 업로드한 본문을 PutObject와 같은 곳에 보관합니다. 본문을 끝까지 읽지 못하면 저장하지 않습니다.
+func (f *fakeS3Putter) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	body, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.PutObjectWithContext(ctx, &s3.PutObjectInput{Bucket: input.Bucket, Key: input.Key, Body: bytes.NewReader(body)})
+	return &s3manager.UploadOutput{}, err
+}
+
+// brokenS3Putter는 항상 실패하는 S3입니다.
+type brokenS3Putter struct{}
+
+func (brokenS3Putter) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return nil, errors.New("access denied")
+}
+
+// UploadWithContext는 본문을 읽지 않고 바로 실패합니다.
+func (brokenS3Putter) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	return nil, errors.New("access denied")
+}
+
+func TestHandlerArchivesBulkRequests(t *testing.T) {
+	testCases := []struct {
+		name      string
+		streaming string
+		gzip      bool
+	}{
+		{name: "buffered"},
+		{name: "streaming", streaming: "true"},
+		{name: "gzipped", gzip: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "BATCH_SIZE", "2")
+			setenv(t, "BULK_STREAMING", testCase.streaming)
+			ocf := writeOCF(t, testProductSchema, productRecords(3)...)
+			recorder := newBulkRecorder(t)
+			putter := &fakeS3Putter{}
+			h := &handler{
+				config:     testConfig(t),
+				s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feeds/feed.avro": ocf}},
+				openSearch: testClient(t, recorder.URL),
+				archive:    &bulkArchiver{client: putter, uploader: putter, bucket: "audit-bucket", prefix: "bulk", gzip: testCase.gzip},
+			}
+			if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feeds/feed.avro")); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			suffix := ".ndjson"
+			if testCase.gzip {
+				suffix += ".gz"
+			}
+			sent := map[string]bool{}
+			for _, body := range recorder.requests {
+				sent[string(body)] = true
+			}
+			for _, batch := range []string{"000000", "000001"} {
+				key := "audit-bucket/bulk/feed-bucket/feeds/feed.avro/batch-" + batch + "-000" + suffix
+				archived, ok := putter.objects[key]
+				if !ok {
+					t.Fatalf("Expected %s to be archived, but got %v", key, objectNames(putter.objects))
+				}
+				if testCase.gzip {
+					zr, err := gzip.NewReader(bytes.NewReader(archived))
+					if err != nil {
+						t.Fatalf("Expected a gzipped archive, but got %v", err)
+					}
+					archived, _ = io.ReadAll(zr)
+				}
+				if !sent[string(archived)] {
+					t.Errorf("Expected %s to match a sent bulk body, but got %s", key, archived)
+				}
+			}
+			if len(putter.objects) != 2 {
+				t.Errorf("Expected 2 archived requests, but got %v", objectNames(putter.objects))
+			}
+		})
+	}
+}
+
+func TestHandlerArchivesEveryStreamingAttempt(t *testing.T) {
+	setenv(t, "BULK_STREAMING", "true")
+	setenv(t, "OPENSEARCH_RETRY_BASE_DELAY_MS", "1")
+	var attempts int32
+	var sent [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sent = append(sent, body)
+		// 첫 시도는 본문을 다 받은 뒤 503으로 거절합니다.
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	ocf := writeOCF(t, testProductSchema, productRecords(2)...)
+	putter := &fakeS3Putter{}
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+		openSearch: testClient(t, server.URL),
+		archive:    &bulkArchiver{client: putter, uploader: putter, bucket: "audit-bucket"},
+	}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if len(sent) != 2 {
+		t.Fatalf("Expected 2 attempts, but got %d", len(sent))
+	}
+	for i, request := range []string{"000", "001"} {
+		key := "audit-bucket/feed-bucket/feed.avro/batch-000000-" + request + ".ndjson"
+		if archived, ok := putter.objects[key]; !ok || !bytes.Equal(archived, sent[i]) {
+			t.Errorf("Expected %s to match attempt %d, but got %v", key, i+1, objectNames(putter.objects))
+		}
+	}
+}
+
+// progressUploader는 업로드 본문을 읽은 만큼 read에 더합니다.
+type progressUploader struct {
+	read int64
+}
+
+func (u *progressUploader) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, opts ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	buf := make([]byte, 512)
+	for {
+		n, err := input.Body.Read(buf)
+		atomic.AddInt64(&u.read, int64(n))
+		if err == io.EOF {
+			return &s3manager.UploadOutput{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestStreamingArchiveUploadsWhileSending(t *testing.T) {
+	setenv(t, "BULK_STREAMING", "true")
+	uploader := &progressUploader{}
+	var sent, uploaded int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		// 응답하기 전에 이미 보낸 본문이 모두 업로더로 넘어가 있어야 합니다.
+		sent, uploaded = int64(len(body)), atomic.LoadInt64(&uploader.read)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	ocf := writeOCF(t, testProductSchema, productRecords(50)...)
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+		openSearch: testClient(t, server.URL),
+		archive:    &bulkArchiver{client: brokenS3Putter{}, uploader: uploader, bucket: "audit-bucket", required: true},
+	}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if sent == 0 || uploaded != sent {
+		t.Errorf("Expected all %d sent bytes to be uploaded before the response, but got %d", sent, uploaded)
+	}
+}
+
+func TestHandlerArchiveFailure(t *testing.T) {
+	testCases := []struct {
+		name      string
+		required  bool
+		streaming string
+		expectErr bool
+	}{
+		{name: "logged only"},
+		{name: "required", required: true, expectErr: true},
+		{name: "required after streaming", required: true, streaming: "true", expectErr: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "BULK_STREAMING", testCase.streaming)
+			ocf := writeOCF(t, testProductSchema, productRecords(1)...)
+			recorder := newBulkRecorder(t)
+			h := &handler{
+				config:     testConfig(t),
+				s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+				openSearch: testClient(t, recorder.URL),
+				archive:    &bulkArchiver{client: brokenS3Putter{}, uploader: brokenS3Putter{}, bucket: "audit-bucket", required: testCase.required},
+			}
+			summary, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro"))
+			if testCase.expectErr {
+				if err == nil || !strings.Contains(err.Error(), "error archiving bulk request") {
+					t.Errorf("Expected an archive error, but got %v", err)
+				}
+				// 스트리밍 본문은 보낸 뒤에 저장하므로 색인된 문서는 실패로 세지 않습니다.
+				if testCase.streaming != "" {
+					if len(recorder.requests) != 1 || summary.DocumentsIndexed != 1 || summary.DocumentsFailed != 0 {
+						t.Errorf("Expected 1 request with 1 indexed document, but got %d requests and %+v", len(recorder.requests), summary)
+					}
+					return
+				}
+				// 저장하기 전에 실패했으므로 보내지 않습니다.
+				if len(recorder.requests) != 0 {
+					t.Errorf("Expected no bulk request, but got %d", len(recorder.requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected archive failures not to fail indexing, but got %v", err)
+			}
+			if len(recorder.requests) != 1 {
+				t.Errorf("Expected 1 bulk request, but got %d", len(recorder.requests))
+			}
+		})
+	}
+}
+
+func objectNames(objects map[string][]byte) []string {
+	var names []string
+	for name := range objects {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+func TestBasicAuthorizer(t *testing.T) {
+	var username, password string
+	var ok bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok = r.BasicAuth()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	client, err := newOpenSearchClient(server.URL, basicAuthorizer{username: "admin", password: "secret"}, newHTTPTransport(defaultRequestTimeout, nil, nil))
+	if err != nil {
+		t.Fatalf("Expected OpenSearch client, but got %v", err)
+	}
+	if _, err := indexBatchToOpenSearch(context.Background(), []interface{}{map[string]interface{}{"productId": "p1"}}, client, testIndexOptions(t)); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if !ok || username != "admin" || password != "secret" {
+		t.Errorf("Expected basic auth admin/secret, but got %v/%v", username, password)
+	}
+}
+
+func TestBasicAuthorizerFromURL(t *testing.T) {
+	testCases := []struct {
+		name             string
+		userinfo         string
+		username         string
+		password         string
+		expectedUsername string
+		expectedPassword string
+	}{
+		{name: "URL credentials", userinfo: "admin:s%40cret@", expectedUsername: "admin", expectedPassword: "s@cret"},
+		{name: "env overrides URL", userinfo: "admin:s%40cret@", username: "indexer", password: "other", expectedUsername: "indexer", expectedPassword: "other"},
+		{name: "env only", username: "indexer", password: "other", expectedUsername: "indexer", expectedPassword: "other"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var username, password string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				username, password, _ = r.BasicAuth()
+				w.Write([]byte(`{"errors":false,"items":[]}`))
+			}))
+			defer server.Close()
+
+			openSearchURL := strings.Replace(server.URL, "http://", "http://"+testCase.userinfo, 1)
+			setenv(t, "OPENSEARCH_URL", openSearchURL)
+			setenv(t, "OPENSEARCH_AUTH_MODE", "")
+			setenv(t, "OPENSEARCH_SECRET_ARN", "")
+			setenv(t, "OPENSEARCH_USERNAME", testCase.username)
+			setenv(t, "OPENSEARCH_PASSWORD", testCase.password)
+			auth, err := newAuthorizer(nil)
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			client, err := newOpenSearchClient(openSearchURL, auth, newHTTPTransport(defaultRequestTimeout, nil, nil))
+			if err != nil {
+				t.Fatalf("Expected OpenSearch client, but got %v", err)
+			}
+			if _, err := indexBatchToOpenSearch(context.Background(), []interface{}{map[string]interface{}{"productId": "p1"}}, client, testIndexOptions(t)); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if username != testCase.expectedUsername || password != testCase.expectedPassword {
+				t.Errorf("Expected basic auth %v/%v, but got %v/%v", testCase.expectedUsername, testCase.expectedPassword, username, password)
+			}
+		})
+	}
+}
+
+func TestSigV4Authorizer(t *testing.T) {
+	body := []byte(`{"index":{"_index":"products","_id":"p1"}}` + "\n" + `{"productId":"p1"}` + "\n")
+	hash := sha256.Sum256(body)
+	testCases := []struct {
+		name    string
+		service string
+		// 다시 읽을 수 없는 BULK_STREAMING 본문인지 여부
+		streamed     bool
+		expectedHash string
+	}{
+		{name: "managed domain", service: "es", expectedHash: hex.EncodeToString(hash[:])},
+		{name: "serverless collection", service: "aoss", expectedHash: hex.EncodeToString(hash[:])},
+		{name: "streamed body to managed domain", service: "es", streamed: true, expectedHash: hex.EncodeToString(hash[:])},
+		{name: "streamed body to serverless collection", service: "aoss", streamed: true, expectedHash: "UNSIGNED-PAYLOAD"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "https://search.example.com/_bulk", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			// 파이프로 보내는 본문처럼 GetBody가 없고, 서명이 본문을 다 읽어 버리는지 확인할 수 있게 합니다.
+			var read int
+			if testCase.streamed {
+				req.Body = io.NopCloser(&countingReader{r: bytes.NewReader(body), n: &read})
+				req.GetBody = nil
+			}
+
+			creds := credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", "")
+			auth := newSigV4Authorizer(creds, testCase.service, "ap-northeast-2")
+			if err := auth.SignRequest(req); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			authorization := req.Header.Get("Authorization")
+			if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+				t.Errorf("Expected SigV4 Authorization header, but got %q", authorization)
+			}
+			scope := "/ap-northeast-2/" + testCase.service + "/aws4_request"
+			if !strings.Contains(authorization, scope) {
+				t.Errorf("Expected credential scope %q, but got %q", scope, authorization)
+			}
+			if req.Header.Get("X-Amz-Date") == "" {
+				t.Errorf("Expected X-Amz-Date header to be set")
+			}
+			if contentHash := req.Header.Get("X-Amz-Content-Sha256"); contentHash != testCase.expectedHash {
+				t.Errorf("Expected X-Amz-Content-Sha256 %q, but got %q", testCase.expectedHash, contentHash)
+			}
+			if testCase.expectedHash == "UNSIGNED-PAYLOAD" && read != 0 {
+				t.Errorf("Expected the streamed body not to be read for signing, but %d bytes were read", read)
+			}
+			if !strings.Contains(authorization, "x-amz-content-sha256") {
+				t.Errorf("Expected the content hash header to be signed, but got %q", authorization)
+			}
+			// 서명 후에도 본문을 그대로 보낼 수 있어야 합니다.
+			if sent, _ := io.ReadAll(req.Body); !bytes.Equal(sent, body) {
+				t.Errorf("Expected body to be preserved after signing, but got %q", sent)
+			}
+		})
+	}
+}
+
+func TestSigV4AuthorizerSignsClientRequests(t *testing.T) {
+	testCases := []struct {
+		name         string
+		service      string
+		streaming    string
+		expectedHash string
+	}{
+		{name: "managed domain", service: "es"},
+		{name: "streaming to serverless collection", service: "aoss", streaming: "true", expectedHash: "UNSIGNED-PAYLOAD"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "BULK_STREAMING", testCase.streaming)
+			var authorization, contentHash string
+			var received []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				contentHash = r.Header.Get("X-Amz-Content-Sha256")
+				received, _ = io.ReadAll(r.Body)
+				w.Write([]byte(`{"errors":false,"items":[]}`))
+			}))
+			defer server.Close()
+
+			creds := credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", "")
+			client, err := newOpenSearchClient(server.URL, newSigV4Authorizer(creds, testCase.service, "ap-northeast-2"), newHTTPTransport(defaultRequestTimeout, nil, nil))
+			if err != nil {
+				t.Fatalf("Expected OpenSearch client, but got %v", err)
+			}
+			if _, err := indexBatchToOpenSearch(context.Background(), []interface{}{map[string]interface{}{"productId": "p1"}}, client, testIndexOptions(t)); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+				t.Errorf("Expected signed request, but got Authorization %q", authorization)
+			}
+			if testCase.expectedHash != "" && contentHash != testCase.expectedHash {
+				t.Errorf("Expected X-Amz-Content-Sha256 %q, but got %q", testCase.expectedHash, contentHash)
+			}
+			if !bytes.Contains(received, []byte(`"productId":"p1"`)) {
+				t.Errorf("Expected the document in the signed body, but got %q", received)
+			}
+		})
+	}
+}
+
+// fakeSecrets는 호출될 때마다 secrets를 차례로 반환합니다. 마지막 값은 계속 반환합니다.
+type fakeSecrets struct {
+	secrets []string
+	calls   int
+}
+
+func (f *fakeSecrets) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	secret := f.secrets[min(f.calls, len(f.secrets)-1)]
+	f.calls++
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+func TestSecretAuthorizerRefreshesOnAuthFailure(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// 시크릿이 교체되어 새 비밀번호만 통과합니다.
+		if username, password, _ := r.BasicAuth(); username != "admin" || password != "rotated" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Contains(body, []byte(`"productId":"p1"`)) {
+			t.Errorf("Expected the bulk body to be resent, but got %s", body)
+		}
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	secrets := &fakeSecrets{secrets: []string{
+		`{"username":"admin","password":"old"}`,
+		`{"username":"admin","password":"rotated"}`,
+	}}
+	client, err := newOpenSearchClient(server.URL, newSecretAuthorizer(secrets, "opensearch"), newHTTPTransport(defaultRequestTimeout, nil, nil))
+	if err != nil {
+		t.Fatalf("Expected OpenSearch client, but got %v", err)
+	}
+	batch := []interface{}{map[string]interface{}{"productId": "p1"}}
+	for i := 0; i < 2; i++ {
+		if _, err := indexBatchToOpenSearch(context.Background(), batch, client, testIndexOptions(t)); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+
+	// 첫 요청만 401 후 재시도하고, 이후에는 캐시된 자격 증명을 씁니다.
+	if secrets.calls != 2 {
+		t.Errorf("Expected the secret to be read twice, but got %d", secrets.calls)
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, but got %d", requests)
+	}
+}
+
+func TestSecretAuthorizerRejectsInvalidSecret(t *testing.T) {
+	testCases := []struct {
+		name     string
+		secret   string
+		expected string
+	}{
+		{name: "not JSON", secret: "admin:secret", expected: "is not a JSON object"},
+		{name: "missing password", secret: `{"username":"admin"}`, expected: "has no username or password"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			auth := newSecretAuthorizer(&fakeSecrets{secrets: []string{testCase.secret}}, "opensearch")
+			req := httptest.NewRequest("POST", "/_bulk", nil)
+			if _, err := auth.credentials(req); err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+// countingReader는 읽은 바이트 수를 n에 더합니다.
+type countingReader struct {
+	r io.Reader
+	n *int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += n
+	return n, err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 차단기가 열린 뒤 다시 요청을 보내 보기까지의 기본 대기 시간
+const defaultCircuitBreakerCooldown = 30 * time.Second
+
+// errCircuitOpen은 차단기가 열려 있어 _bulk 요청을 보내지 않았음을 나타냅니다.
+var errCircuitOpen = errors.New("OpenSearch circuit breaker is open")
+
+// circuitBreaker는 _bulk 요청이 threshold번 연달아 실패하면 cooldown 동안 요청을 보내지 않고 바로 실패시킵니다.
+// cooldown이 지나면(half-open) 요청 하나만 probe로 보내 보고, 그 결과가 나올 때까지 나머지는 계속 막습니다.
+// probe가 실패하면 곧바로 다시 열리고, 성공하면 닫힙니다.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	// 연달아 실패한 요청 수
+	failures int
+	// 차단기가 열려 있는 마지막 시각 (이후에는 probe를 보냄). 닫혀 있으면 zero입니다.
+	openUntil time.Time
+	// half-open에서 probe가 나가 있는지 여부. 여러 워커 중 CAS에 성공한 하나만 probe를 보냅니다.
+	probing atomic.Bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow는 차단기가 열려 있으면 남은 시간을 담은 errCircuitOpen을 반환합니다.
+// half-open이면 처음 부른 요청만 probe로 허용하고, 그 결과를 record할 때까지 나머지에는 errCircuitOpen을 반환합니다.
+// nil이면 항상 허용합니다.
+func (b *circuitBreaker) allow() error {
+	return b.admit(true)
+}
+
+// check는 allow와 같지만 probe 차례를 차지하지 않습니다. 호출을 시작하기 전에 확인할 때 씁니다.
+func (b *circuitBreaker) check() error {
+	return b.admit(false)
+}
+
+func (b *circuitBreaker) admit(probe bool) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	openUntil, failures := b.openUntil, b.failures
+	b.mu.Unlock()
+	if openUntil.IsZero() {
+		return nil
+	}
+	if remaining := time.Until(openUntil); remaining > 0 {
+		return fmt.Errorf("%w after %d consecutive bulk failures, retry in %s", errCircuitOpen, failures, remaining.Round(time.Second))
+	}
+	// 그 사이 probe 결과로 닫혔다면 남는 probing 값은 다음에 열릴 때 지워집니다.
+	if probe && b.probing.CompareAndSwap(false, true) || !probe && !b.probing.Load() {
+		return nil
+	}
+	return fmt.Errorf("%w after %d consecutive bulk failures, waiting for the probe request", errCircuitOpen, failures)
+}
+
+// release는 결과를 알 수 없이 끝난 요청(컨텍스트 취소 등) 뒤에 다음 요청이 다시 probe를 보낼 수 있게 합니다.
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.probing.Store(false)
+}
+
+// record는 _bulk 요청 하나의 결과를 반영합니다.
+// 연결 실패와 5xx/429처럼 재시도할 오류만 실패로 세고, 응답을 받았으면 클러스터가 살아 있으므로 다시 셉니다.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	var retryErr *retryableError
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !errors.As(err, &retryErr) {
+		if !b.openUntil.IsZero() {
+			logger.Info("closing OpenSearch circuit breaker")
+		}
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing.Store(false)
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		if time.Now().After(b.openUntil) {
+			logger.Warn("opening OpenSearch circuit breaker", "consecutive_failures", b.failures, "cooldown", b.cooldown.String(), "error", err)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+		b.probing.Store(false)
+	}
+}
+
+// 같은 컨테이너의 워커와 웜 호출이 모두 같은 차단기를 나눠 쓰도록 하나만 만들어 둡니다.
+var bulkBreakers struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breaker   *circuitBreaker
+}
+
+// bulkBreakerFromEnv는 CIRCUIT_BREAKER_THRESHOLD와 CIRCUIT_BREAKER_COOLDOWN_SECONDS에 맞는 공유 차단기를 반환합니다.
+// threshold가 0이면 사용하지 않으므로 nil입니다.
+func bulkBreakerFromEnv() *circuitBreaker {
+	threshold := envInt("CIRCUIT_BREAKER_THRESHOLD", 0)
+	if threshold <= 0 {
+		return nil
+	}
+	cooldown := envDurationSeconds("CIRCUIT_BREAKER_COOLDOWN_SECONDS", defaultCircuitBreakerCooldown)
+	bulkBreakers.mu.Lock()
+	defer bulkBreakers.mu.Unlock()
+	if bulkBreakers.breaker == nil || bulkBreakers.threshold != threshold || bulkBreakers.cooldown != cooldown {
+		bulkBreakers.threshold = threshold
+		bulkBreakers.cooldown = cooldown
+		bulkBreakers.breaker = newCircuitBreaker(threshold, cooldown)
+	}
+	return bulkBreakers.breaker
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := newCircuitBreaker(2, 50*time.Millisecond)
+	unavailable := &retryableError{err: errors.New("error response from OpenSearch: 503 Service Unavailable")}
+
+	breaker.record(unavailable)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("Expected the breaker to stay closed after one failure, but got %v", err)
+	}
+	// 응답을 받은 요청은 연속 실패를 끊습니다.
+	breaker.record(errors.New("error response from OpenSearch: 400 Bad Request"))
+	breaker.record(unavailable)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("Expected the failure count to reset, but got %v", err)
+	}
+	breaker.record(unavailable)
+	if err := breaker.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Expected errCircuitOpen after 2 consecutive failures, but got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("Expected a trial request after the cooldown, but got %v", err)
+	}
+	// 쿨다운 뒤 첫 요청이 실패하면 바로 다시 열립니다.
+	breaker.record(unavailable)
+	if err := breaker.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Expected the breaker to reopen, but got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	breaker.record(nil)
+	breaker.record(unavailable)
+	if err := breaker.allow(); err != nil {
+		t.Errorf("Expected the breaker to close after a success, but got %v", err)
+	}
+
+	var disabled *circuitBreaker
+	disabled.record(unavailable)
+	if err := disabled.allow(); err != nil {
+		t.Errorf("Expected a nil breaker to allow requests, but got %v", err)
+	}
+}
+
+func TestCircuitBreakerAdmitsOneProbe(t *testing.T) {
+	unavailable := &retryableError{err: errors.New("error response from OpenSearch: 503 Service Unavailable")}
+	testCases := []struct {
+		name string
+		// probe의 결과
+		finish func(breaker *circuitBreaker)
+		// probe가 끝난 뒤 요청이 허용되는지 여부
+		expectedAllowed bool
+	}{
+		{name: "probe succeeds", finish: func(breaker *circuitBreaker) { breaker.record(nil) }, expectedAllowed: true},
+		{name: "probe fails", finish: func(breaker *circuitBreaker) { breaker.record(unavailable) }},
+		{name: "probe is cancelled", finish: func(breaker *circuitBreaker) { breaker.release() }, expectedAllowed: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			breaker := newCircuitBreaker(1, 20*time.Millisecond)
+			breaker.record(unavailable)
+			time.Sleep(30 * time.Millisecond)
+			// 호출 전 확인은 probe 차례를 차지하지 않습니다.
+			if err := breaker.check(); err != nil {
+				t.Fatalf("Expected check to pass after the cooldown, but got %v", err)
+			}
+
+			var wg sync.WaitGroup
+			var admitted int32
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if breaker.allow() == nil {
+						atomic.AddInt32(&admitted, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			if admitted != 1 {
+				t.Fatalf("Expected exactly 1 probe to be admitted, but got %d", admitted)
+			}
+			if err := breaker.check(); !errors.Is(err, errCircuitOpen) {
+				t.Errorf("Expected check to fail while the probe is in flight, but got %v", err)
+			}
+
+			testCase.finish(breaker)
+			if err := breaker.allow(); (err == nil) != testCase.expectedAllowed {
+				t.Errorf("Expected allowed=%v after the probe, but got %v", testCase.expectedAllowed, err)
+			}
+		})
+	}
+}
+
+func TestHandleRequestFailsFastWhenBreakerIsOpen(t *testing.T) {
+	setenv(t, "CIRCUIT_BREAKER_THRESHOLD", "3")
+	setenv(t, "CIRCUIT_BREAKER_COOLDOWN_SECONDS", "60")
+	setenv(t, "OPENSEARCH_MAX_RETRIES", "5")
+	setenv(t, "OPENSEARCH_RETRY_BASE_DELAY_MS", "1")
+	t.Cleanup(func() { bulkBreakers.breaker = nil })
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/products.avro": writeOCF(t, testProductSchema, productRecords(1)...)}}
+	sharedHandlerMu.Lock()
+	sharedHandler = &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, server.URL)}
+	sharedHandlerMu.Unlock()
+	t.Cleanup(func() {
+		sharedHandlerMu.Lock()
+		sharedHandler = nil
+		sharedHandlerMu.Unlock()
+	})
+
+	payload, err := json.Marshal(s3Event("feed-bucket", "products.avro"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3번 연달아 실패하면 남은 재시도를 보내지 않습니다.
+	if _, err := HandleRequest(context.Background(), payload); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Expected errCircuitOpen, but got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("Expected 3 bulk requests before the breaker opened, but got %d", n)
+	}
+
+	// 열린 동안의 호출은 객체를 읽지도 않고 바로 실패합니다.
+	gets := len(s3Client.inputs)
+	if _, err := HandleRequest(context.Background(), payload); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Expected errCircuitOpen, but got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("Expected no bulk requests while the breaker is open, but got %d", n)
+	}
+	if len(s3Client.inputs) != gets {
+		t.Errorf("Expected no S3 reads while the breaker is open, but got %d", len(s3Client.inputs)-gets)
+	}
+}
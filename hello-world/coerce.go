@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// COERCION_CONFIG에서 쓸 수 있는 대상 타입
+const (
+	coerceFloat  = "float"
+	coerceInt    = "int"
+	coerceBool   = "bool"
+	coerceString = "string"
+	coerceDate   = "date"
+)
+
+var coercionTypes = []string{coerceFloat, coerceInt, coerceBool, coerceString, coerceDate}
+
+// parseCoercions는 COERCION_CONFIG({"price":"float","active":"bool"})를 읽습니다.
+// 알 수 없는 타입이 있으면 오류를 반환합니다.
+func parseCoercions(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var coercions map[string]string
+	if err := json.Unmarshal([]byte(value), &coercions); err != nil {
+		return nil, fmt.Errorf("invalid COERCION_CONFIG: %w", err)
+	}
+	var unknown []string
+	for field, target := range coercions {
+		if !isCoercionType(target) {
+			unknown = append(unknown, fmt.Sprintf("%s: %q", field, target))
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("invalid COERCION_CONFIG: unknown target types (%s), expected one of %s",
+			strings.Join(unknown, ", "), strings.Join(coercionTypes, ", "))
+	}
+	return coercions, nil
+}
+
+func isCoercionType(target string) bool {
+	for _, known := range coercionTypes {
+		if target == known {
+			return true
+		}
+	}
+	return false
+}
+
+// coercionsFromEnv는 COERCION_CONFIG를 읽습니다. 잘못된 설정은 validateConfig가 시작할 때 막으므로
+// 여기서는 경고만 남기고 변환하지 않습니다.
+func coercionsFromEnv() map[string]string {
+	coercions, err := parseCoercions(os.Getenv("COERCION_CONFIG"))
+	if err != nil {
+		logger.Warn("fields are not coerced", "error", err)
+		return nil
+	}
+	return coercions
+}
+
+// coerceFields는 coercions에 지정된 필드를 대상 타입으로 바꿉니다.
+// 변환할 수 없는 값은 원래 값을 유지하고 경고를 남깁니다. null과 없는 필드는 건드리지 않습니다.
+func coerceFields(raw map[string]interface{}, coercions map[string]string) {
+	for field, target := range coercions {
+		value, ok := raw[field]
+		if !ok || value == nil {
+			continue
+		}
+		coerced, err := coerceValue(value, target)
+		if err != nil {
+			logger.Warn("failed to coerce field", "field", field, "type", target, "value", value, "error", err)
+			continue
+		}
+		raw[field] = coerced
+	}
+}
+
+// coerceValue는 값 하나를 대상 타입으로 바꿉니다.
+func coerceValue(value interface{}, target string) (interface{}, error) {
+	switch target {
+	case coerceFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case json.Number:
+			return v.Float64()
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		}
+	case coerceInt:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int32:
+			return int64(v), nil
+		case float64:
+			return integralFloat(v)
+		case float32:
+			return integralFloat(float64(v))
+		case json.Number:
+			return coerceValue(v.String(), target)
+		case string:
+			s := strings.TrimSpace(v)
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return n, nil
+			}
+			// "12.0"처럼 소수점이 있는 정수도 받습니다.
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, err
+			}
+			return integralFloat(f)
+		}
+	case coerceBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(v))
+		case int64, int32, float64, float32, json.Number:
+			// 0과 1만 불리언으로 봅니다.
+			switch fmt.Sprint(v) {
+			case "0":
+				return false, nil
+			case "1":
+				return true, nil
+			}
+		}
+	case coerceString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case float32:
+			return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+		case int64, int32, bool, json.Number:
+			return fmt.Sprint(v), nil
+		}
+	case coerceDate:
+		// 숫자는 epoch 밀리초, 문자열은 RFC3339 또는 날짜(2006-01-02)로 읽어 UTC ISO-8601로 씁니다.
+		if s, ok := value.(string); ok {
+			if t, err := time.Parse("2006-01-02", strings.TrimSpace(s)); err == nil {
+				return t.UTC().Format(time.RFC3339Nano), nil
+			}
+		}
+		if t, ok := recordTimestamp(value); ok {
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %T to %s", value, target)
+}
+
+// integralFloat는 소수 부분이 없는 실수만 정수로 바꿉니다.
+func integralFloat(f float64) (int64, error) {
+	if f != math.Trunc(f) || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("%v is not an integer", f)
+	}
+	return int64(f), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoerceFields(t *testing.T) {
+	coercions := map[string]string{
+		"price":     "float",
+		"stock":     "int",
+		"rank":      "int",
+		"active":    "bool",
+		"soldOut":   "bool",
+		"sku":       "string",
+		"rating":    "string",
+		"createdAt": "date",
+		"releaseOn": "date",
+		"updatedAt": "date",
+		"discount":  "float",
+		"badStock":  "int",
+		"absent":    "float",
+		"barcode":   "int",
+		"weight":    "float",
+	}
+	raw := map[string]interface{}{
+		"price":     "19900.5",
+		"stock":     "12",
+		"rank":      float64(3),
+		"active":    "true",
+		"soldOut":   int64(0),
+		"sku":       int64(1234567890123),
+		"rating":    4.5,
+		"createdAt": int64(1700000000123),
+		"releaseOn": "2024-01-02",
+		"updatedAt": "2024-01-02T12:00:00+09:00",
+		"discount":  nil,
+		"badStock":  "1.5",
+		// JSON 입력은 숫자를 json.Number로 읽습니다.
+		"barcode": json.Number("1234567890123456789"),
+		"weight":  json.Number("0.25"),
+	}
+	expected := map[string]interface{}{
+		"price":     19900.5,
+		"stock":     int64(12),
+		"rank":      int64(3),
+		"active":    true,
+		"soldOut":   false,
+		"sku":       "1234567890123",
+		"rating":    "4.5",
+		"createdAt": "2023-11-14T22:13:20.123Z",
+		"releaseOn": "2024-01-02T00:00:00Z",
+		"updatedAt": "2024-01-02T03:00:00Z",
+		"discount":  nil,
+		// 변환할 수 없는 값은 그대로 둡니다.
+		"badStock": "1.5",
+		"barcode":  int64(1234567890123456789),
+		"weight":   0.25,
+	}
+
+	coerceFields(raw, coercions)
+	if !reflect.DeepEqual(raw, expected) {
+		t.Errorf("Expected %v, but got %v", expected, raw)
+	}
+}
+
+func TestParseCoercions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "unset", value: ""},
+		{name: "known types", value: `{"price":"float","stock":"int","active":"bool","sku":"string","createdAt":"date"}`},
+		{name: "unknown type", value: `{"price":"number","stock":"int"}`, expected: `unknown target types (price: "number")`},
+		{name: "not an object", value: `["price"]`, expected: "invalid COERCION_CONFIG"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseCoercions(testCase.value)
+			if testCase.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt는 정수 환경 변수를 읽습니다. 값이 없거나 잘못되면 기본값을 사용합니다.
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warn("invalid environment variable, using default", "name", key, "value", value, "default", def)
+		return def
+	}
+	return n
+}
+
+// envDurationMillis는 밀리초 단위 환경 변수를 time.Duration으로 읽습니다.
+func envDurationMillis(key string, def time.Duration) time.Duration {
+	return time.Duration(envInt(key, int(def/time.Millisecond))) * time.Millisecond
+}
+
+// envDurationSeconds는 초 단위 환경 변수를 time.Duration으로 읽습니다.
+func envDurationSeconds(key string, def time.Duration) time.Duration {
+	return time.Duration(envInt(key, int(def/time.Second))) * time.Second
+}
+
+// envBool은 불리언 환경 변수를 읽습니다. 값이 없거나 잘못되면 기본값을 사용합니다.
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warn("invalid environment variable, using default", "name", key, "value", value, "default", def)
+		return def
+	}
+	return b
+}
+
+// envList는 쉼표로 구분된 환경 변수를 읽습니다. 빈 항목은 무시하며, 값이 없으면 기본값을 사용합니다.
+func envList(key string, def []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// validateConfig는 시작할 때 필수 설정을 확인합니다.
+// 잘못된 설정은 첫 배치를 보낼 때가 아니라 여기서 바로 드러납니다.
+func validateConfig() error {
+	var errs []error
+	if _, err := normalizeOpenSearchURL(os.Getenv("OPENSEARCH_URL")); err != nil {
+		errs = append(errs, err)
+	}
+	switch mode := os.Getenv("OPENSEARCH_AUTH_MODE"); mode {
+	case "", authModeBasic:
+		if creds := basicCredentialsFromEnv(); os.Getenv("OPENSEARCH_SECRET_ARN") == "" && (creds.username == "" || creds.password == "") {
+			errs = append(errs, errors.New("OPENSEARCH_SECRET_ARN or OPENSEARCH_USERNAME and OPENSEARCH_PASSWORD are required for basic auth (or user:password in OPENSEARCH_URL)"))
+		}
+	case authModeSigV4:
+		switch service := signingServiceFromEnv(); service {
+		case signingServiceES, signingServiceAOSS:
+		default:
+			errs = append(errs, fmt.Errorf("unknown OPENSEARCH_SERVICE %q (expected %q or %q)", service, signingServiceES, signingServiceAOSS))
+		}
+		// 관리형 도메인은 본문 해시를 서명해야 하므로 스트리밍 본문도 서명하기 전에 메모리에 모읍니다.
+		if signingServiceFromEnv() == signingServiceES && envBool("BULK_STREAMING", false) {
+			logger.Warn("BULK_STREAMING bodies are buffered in memory for SigV4 signing; only OPENSEARCH_SERVICE=aoss streams them unsigned")
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown OPENSEARCH_AUTH_MODE %q (expected %q or %q)", mode, authModeBasic, authModeSigV4))
+	}
+	if _, err := bulkOpTypeFromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseFieldCondition(os.Getenv("DELETE_WHEN_FIELD_EQUALS")); err != nil {
+		errs = append(errs, fmt.Errorf("invalid DELETE_WHEN_FIELD_EQUALS: %w", err))
+	}
+	if _, err := parseCoercions(os.Getenv("COERCION_CONFIG")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseValidationRules(os.Getenv("VALIDATION_CONFIG")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseOversizedFieldAction(os.Getenv("OVERSIZED_FIELD_ACTION")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseBytesEncoding(os.Getenv("BYTES_ENCODING")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseDecimalFormat(os.Getenv("DECIMAL_FORMAT")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseProxyURL(os.Getenv("OPENSEARCH_PROXY")); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateSchemaRegistry(os.Getenv("SCHEMA_REGISTRY_URL"), os.Getenv("SCHEMA_REGISTRY_SUBJECT")); err != nil {
+		errs = append(errs, err)
+	}
+	if value := os.Getenv("ENRICHMENT_S3_URI"); value != "" {
+		if _, err := parseEnrichmentURI(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if _, err := parseFlushInterval(os.Getenv("FLUSH_INTERVAL")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseBulkRPS(os.Getenv("BULK_RPS")); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := parseSampleRate(os.Getenv("SAMPLE_RATE")); err != nil {
+		errs = append(errs, err)
+	}
+	if value := os.Getenv("ARCHIVE_BULK_S3_PREFIX"); value != "" {
+		if _, _, err := parseArchiveURI(value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if value := os.Getenv("READ_BUFFER_BYTES"); value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+			errs = append(errs, fmt.Errorf("invalid READ_BUFFER_BYTES %q (expected a positive number of bytes)", value))
+		}
+	}
+	if refresh := os.Getenv("REFRESH"); !validRefresh(refresh) {
+		errs = append(errs, fmt.Errorf("invalid REFRESH %q (expected true, false or wait_for)", refresh))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
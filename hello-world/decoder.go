@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+const (
+	formatAvroOCF   = "avro"
+	formatJSONLines = "ndjson"
+	// JSON Lines 한 줄의 최대 크기
+	maxJSONLineBytes = 16 << 20
+)
+
+// RecordDecoder는 S3 객체 본문에서 레코드를 하나씩 꺼냅니다.
+// goavro.OCFReader처럼 Scan으로 다음 레코드가 있는지 확인하고 Record로 읽습니다.
+type RecordDecoder interface {
+	// Scan은 읽을 레코드가 남아 있으면 true를 반환합니다.
+	Scan() bool
+	// Record는 현재 레코드를 반환합니다. 오류가 나도 Err가 nil이면 해당 레코드만 건너뛰면 됩니다.
+	Record() (map[string]interface{}, error)
+	// Err는 더 이상 읽을 수 없게 만든 오류를 반환합니다 (손상된 OCF 블록 등).
+	Err() error
+}
+
+// objectFormat은 키 확장자(.gz 제외)와 Content-Type으로 객체 형식을 고릅니다.
+// 어느 쪽으로도 알 수 없으면 기존처럼 Avro OCF로 읽습니다.
+func objectFormat(key, contentType string) string {
+	switch strings.ToLower(path.Ext(strings.TrimSuffix(key, ".gz"))) {
+	case ".ndjson", ".jsonl":
+		return formatJSONLines
+	case ".avro":
+		return formatAvroOCF
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return formatJSONLines
+	}
+	return formatAvroOCF
+}
+
+// newRecordDecoder는 형식에 맞는 RecordDecoder를 만듭니다.
+func newRecordDecoder(format string, r io.Reader) (RecordDecoder, error) {
+	switch format {
+	case formatJSONLines:
+		return newJSONLinesDecoder(r), nil
+	default:
+		ocfr, err := goavro.NewOCFReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error creating OCF reader: %w", err)
+		}
+		return &avroOCFDecoder{ocfr: ocfr}, nil
+	}
+}
+
+// avroOCFDecoder는 Avro OCF 파일의 레코드를 읽습니다.
+type avroOCFDecoder struct {
+	ocfr *goavro.OCFReader
+	// 지금까지 Scan한 레코드 수와 현재 블록 번호 (둘 다 1부터). 오류가 난 위치를 알리는 데 씁니다.
+	records int
+	blocks  int
+	// Read가 실패한 위치를 붙인 오류 (goavro는 Read가 실패하면 더 읽지 않음)
+	readErr error
+}
+
+func (d *avroOCFDecoder) Scan() bool {
+	// 현재 블록을 다 읽었으면 Scan이 다음 블록을 읽습니다.
+	if d.ocfr.RemainingBlockItems() <= 0 {
+		d.blocks++
+	}
+	if !d.ocfr.Scan() {
+		return false
+	}
+	d.records++
+	return true
+}
+
+func (d *avroOCFDecoder) Err() error {
+	err := d.ocfr.Err()
+	if err == nil {
+		return nil
+	}
+	if d.readErr != nil {
+		return d.readErr
+	}
+	return fmt.Errorf("block %d: %w", d.blocks, err)
+}
+
+// writerSchema는 파일 헤더에 들어 있는 writer 스키마입니다.
+func (d *avroOCFDecoder) writerSchema() string { return d.ocfr.Codec().Schema() }
+
+// schemaFingerprint는 writer 스키마의 Parsing Canonical Form으로 계산한 64비트 Rabin 지문(16자리 hex)입니다.
+// 필드 순서나 타입이 같으면 공백, doc 등이 달라도 같은 값입니다.
+func (d *avroOCFDecoder) schemaFingerprint() string {
+	return fmt.Sprintf("%016x", d.ocfr.Codec().Rabin)
+}
+
+// unionNames는 writer 스키마에 정의된 record, enum, fixed 타입의 전체 이름과 종류를 모읍니다. 스키마를 읽지 못하면 nil을 반환합니다.
+func (d *avroOCFDecoder) unionNames() map[string]string {
+	var schema interface{}
+	if err := json.Unmarshal([]byte(d.writerSchema()), &schema); err != nil {
+		return nil
+	}
+	names := map[string]string{}
+	collectUnionNames(schema, "", names)
+	return names
+}
+
+// collectUnionNames는 이름 있는 타입을 전체 이름 → 종류("record", "enum", "fixed")로 모읍니다.
+// goavro는 union branch 키로 전체 이름을 쓰므로, 네임스페이스를 적지 않은 타입에는 바깥 타입의 네임스페이스를 붙입니다.
+func collectUnionNames(schema interface{}, namespace string, names map[string]string) {
+	switch s := schema.(type) {
+	case []interface{}:
+		for _, branch := range s {
+			collectUnionNames(branch, namespace, names)
+		}
+	case map[string]interface{}:
+		kind, _ := s["type"].(string)
+		if name, ok := s["name"].(string); ok {
+			switch kind {
+			case "record", "error", "enum", "fixed":
+				if i := strings.LastIndex(name, "."); i >= 0 {
+					namespace = name[:i]
+				} else {
+					if ns, ok := s["namespace"].(string); ok {
+						namespace = ns
+					}
+					if namespace != "" {
+						name = namespace + "." + name
+					}
+				}
+				if kind == "error" {
+					kind = "record"
+				}
+				names[name] = kind
+			}
+		}
+		for _, f := range schemaFields(s) {
+			collectUnionNames(f["type"], namespace, names)
+		}
+		collectUnionNames(s["items"], namespace, names)
+		collectUnionNames(s["values"], namespace, names)
+		if nested, ok := s["type"].(map[string]interface{}); ok {
+			collectUnionNames(nested, namespace, names)
+		}
+	}
+}
+
+func (d *avroOCFDecoder) Record() (map[string]interface{}, error) {
+	datum, err := d.ocfr.Read()
+	if err != nil {
+		d.readErr = fmt.Errorf("record %d in block %d: %w", d.records, d.blocks, err)
+		return nil, d.readErr
+	}
+	// 타입 단언을 사용하여 datum을 map[string]interface{} 타입으로 변환
+	record, ok := datum.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record %d in block %d: %w: %T", d.records, d.blocks, errNotRecord, datum)
+	}
+	return record, nil
+}
+
+// jsonLinesDecoder는 한 줄에 JSON 객체 하나씩 담긴 파일(.ndjson)을 읽습니다. 빈 줄은 건너뜁니다.
+type jsonLinesDecoder struct {
+	scanner *bufio.Scanner
+	line    []byte
+	// 현재 줄 번호 (1부터, 빈 줄 포함)
+	lineNo int
+}
+
+func newJSONLinesDecoder(r io.Reader) *jsonLinesDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLineBytes)
+	return &jsonLinesDecoder{scanner: scanner}
+}
+
+func (d *jsonLinesDecoder) Scan() bool {
+	for d.scanner.Scan() {
+		d.lineNo++
+		if line := bytes.TrimSpace(d.scanner.Bytes()); len(line) > 0 {
+			d.line = line
+			return true
+		}
+	}
+	return false
+}
+
+func (d *jsonLinesDecoder) Err() error {
+	if err := d.scanner.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", d.lineNo+1, err)
+	}
+	return nil
+}
+
+func (d *jsonLinesDecoder) Record() (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := unmarshalJSON(d.line, &record); err != nil {
+		return nil, fmt.Errorf("invalid record on line %d: %w", d.lineNo, err)
+	}
+	if record == nil {
+		return nil, fmt.Errorf("line %d: %w", d.lineNo, errNotRecord)
+	}
+	return record, nil
+}
+
+// errNotRecord는 읽은 값이 객체(레코드)가 아니어서 map으로 바꿀 수 없음을 나타냅니다.
+var errNotRecord = errors.New("datum is not a record")
+
+// isTypeAssertError는 레코드 오류가 깨진 데이터가 아니라 객체가 아닌 값(배열, 문자열, null 등) 때문인지 확인합니다.
+func isTypeAssertError(err error) bool {
+	var typeErr *json.UnmarshalTypeError
+	return errors.Is(err, errNotRecord) || errors.As(err, &typeErr)
+}
+
+// unmarshalJSON은 json.Unmarshal과 같지만 숫자를 float64 대신 json.Number로 읽습니다.
+// interface{}로 읽는 값에 19자리 productId 같은 큰 정수가 있어도 정밀도를 잃지 않습니다.
+func unmarshalJSON(data []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return err
+	}
+	// json.Unmarshal처럼 값 뒤에 다른 내용이 있으면 오류로 봅니다.
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid character after top-level value")
+	}
+	return nil
+}
+
+// formatJSONPayload는 직접 호출로 받은 JSON 배열입니다.
+const formatJSONPayload = "json-array"
+
+// payloadDecoder는 직접 호출로 받은 JSON 배열의 원소를 레코드로 읽습니다.
+type payloadDecoder struct {
+	items   []json.RawMessage
+	next    int
+	current json.RawMessage
+}
+
+func (d *payloadDecoder) Scan() bool {
+	if d.next >= len(d.items) {
+		return false
+	}
+	d.current = d.items[d.next]
+	d.next++
+	return true
+}
+
+func (d *payloadDecoder) Err() error { return nil }
+
+func (d *payloadDecoder) Record() (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := unmarshalJSON(d.current, &record); err != nil {
+		return nil, fmt.Errorf("invalid record %d in payload: %w", d.next-1, err)
+	}
+	if record == nil {
+		return nil, fmt.Errorf("record %d in payload: %w", d.next-1, errNotRecord)
+	}
+	return record, nil
+}
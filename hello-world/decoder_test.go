@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestObjectFormat(t *testing.T) {
+	testCases := []struct {
+		name        string
+		key         string
+		contentType string
+		expected    string
+	}{
+		{name: "avro extension", key: "feed/products.avro", expected: formatAvroOCF},
+		{name: "ndjson extension", key: "feed/products.ndjson", expected: formatJSONLines},
+		{name: "jsonl extension", key: "feed/products.JSONL", expected: formatJSONLines},
+		{name: "gzipped ndjson", key: "feed/products.ndjson.gz", expected: formatJSONLines},
+		{name: "content type", key: "feed/products", contentType: "application/x-ndjson; charset=utf-8", expected: formatJSONLines},
+		{name: "extension wins over content type", key: "feed/products.avro", contentType: "application/x-ndjson", expected: formatAvroOCF},
+		{name: "unknown defaults to avro", key: "feed/products", contentType: "binary/octet-stream", expected: formatAvroOCF},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if format := objectFormat(testCase.key, testCase.contentType); format != testCase.expected {
+				t.Errorf("Expected format %q, but got %q", testCase.expected, format)
+			}
+		})
+	}
+}
+
+func TestJSONLinesDecoder(t *testing.T) {
+	input := `{"productId":"p1","price":"100"}
+
+{"productId":"p2"}
+not json
+[1,2]
+{"productId":"p3"}
+`
+	decoder := newJSONLinesDecoder(strings.NewReader(input))
+
+	var ids []interface{}
+	var invalid []string
+	for decoder.Scan() {
+		record, err := decoder.Record()
+		if err != nil {
+			invalid = append(invalid, err.Error())
+			continue
+		}
+		ids = append(ids, record["productId"])
+	}
+	if err := decoder.Err(); err != nil {
+		t.Fatalf("Expected no scan error, but got %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "p1" || ids[2] != "p3" {
+		t.Errorf("Expected records p1, p2, p3, but got %v", ids)
+	}
+	// 빈 줄도 줄 번호에 포함합니다.
+	if len(invalid) != 2 || !strings.Contains(invalid[0], "line 4") || !strings.Contains(invalid[1], "line 5") {
+		t.Errorf("Expected errors for lines 4 and 5, but got %v", invalid)
+	}
+}
+
+func TestHandlerIndexesArraysOfUnions(t *testing.T) {
+	schema := `{
+		"type": "record",
+		"name": "Product",
+		"fields": [
+			{"name": "productId", "type": "string"},
+			{"name": "tags", "type": {"type": "array", "items": ["null", "string"]}},
+			{"name": "sizes", "type": {"type": "array", "items": ["null", "long"]}}
+		]
+	}`
+	ocf := writeOCF(t, schema, map[string]interface{}{
+		"productId": "p1",
+		"tags":      []interface{}{goavro.Union("string", "sale"), nil, goavro.Union("string", "new")},
+		"sizes":     []interface{}{goavro.Union("long", int64(250)), goavro.Union("long", int64(260))},
+	})
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/products.avro": ocf}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "products.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	_, docs := recorder.documents(t)
+	if len(docs) != 1 {
+		t.Fatalf("Expected 1 document, but got %d", len(docs))
+	}
+	expectedTags := []interface{}{"sale", nil, "new"}
+	if !reflect.DeepEqual(docs[0]["tags"], expectedTags) {
+		t.Errorf("Expected tags %v, but got %v", expectedTags, docs[0]["tags"])
+	}
+	expectedSizes := []interface{}{float64(250), float64(260)}
+	if !reflect.DeepEqual(docs[0]["sizes"], expectedSizes) {
+		t.Errorf("Expected sizes %v, but got %v", expectedSizes, docs[0]["sizes"])
+	}
+}
+
+func TestHandlerIndexesNumericProductIDs(t *testing.T) {
+	schema := `{
+		"type": "record",
+		"name": "Product",
+		"fields": [
+			{"name": "productId", "type": ["null", "long", "int"]},
+			{"name": "title", "type": "string"}
+		]
+	}`
+	ocf := writeOCF(t, schema,
+		map[string]interface{}{"productId": goavro.Union("long", int64(9007199254740993)), "title": "long"},
+		map[string]interface{}{"productId": goavro.Union("int", int32(42)), "title": "int"},
+	)
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/products.avro": ocf}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "products.avro"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if summary.RecordsSkipped != 0 {
+		t.Errorf("Expected no skipped records, but got %d", summary.RecordsSkipped)
+	}
+
+	actions, _ := recorder.documents(t)
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 documents, but got %d", len(actions))
+	}
+	for i, expectedID := range []string{"9007199254740993", "42"} {
+		if id := actions[i]["index"].(map[string]interface{})["_id"]; id != expectedID {
+			t.Errorf("Expected _id %s, but got %v", expectedID, id)
+		}
+	}
+}
+
+func TestHandlerIndexesNullableEnums(t *testing.T) {
+	schema := `{
+		"type": "record",
+		"name": "Product",
+		"fields": [
+			{"name": "productId", "type": "string"},
+			{"name": "status", "type": ["null", {"type": "enum", "name": "Status", "symbols": ["ACTIVE", "DELETED"]}]},
+			{"name": "grade", "type": ["null", {"type": "enum", "name": "Grade", "namespace": "com.example", "symbols": ["A", "B"]}]},
+			{"name": "attributes", "type": {"type": "map", "values": "string"}}
+		]
+	}`
+	ocf := writeOCF(t, schema,
+		map[string]interface{}{
+			"productId":  "p1",
+			"status":     goavro.Union("Status", "ACTIVE"),
+			"grade":      goavro.Union("com.example.Grade", "B"),
+			"attributes": map[string]interface{}{"color": "red"},
+		},
+		map[string]interface{}{"productId": "p2", "status": goavro.Union("null", nil), "grade": nil, "attributes": map[string]interface{}{}},
+	)
+	recorder := newBulkRecorder(t)
+	h := &handler{config: testConfig(t), s3: &fakeS3{objects: map[string][]byte{"feed-bucket/products.avro": ocf}}, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "products.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	_, documents := recorder.documents(t)
+	if len(documents) != 2 {
+		t.Fatalf("Expected 2 documents, but got %d", len(documents))
+	}
+	if documents[0]["status"] != "ACTIVE" || documents[0]["grade"] != "B" {
+		t.Errorf("Expected enum symbols ACTIVE and B, but got %v and %v", documents[0]["status"], documents[0]["grade"])
+	}
+	// 값이 하나뿐인 map은 enum branch가 아니므로 그대로 둡니다.
+	if attributes, ok := documents[0]["attributes"].(map[string]interface{}); !ok || attributes["color"] != "red" {
+		t.Errorf("Expected attributes to stay an object, but got %v", documents[0]["attributes"])
+	}
+	if status, ok := documents[1]["status"]; ok && status != nil {
+		t.Errorf("Expected a null status, but got %v", status)
+	}
+}
+
+func TestAvroSchemaFingerprint(t *testing.T) {
+	fingerprint := func(schema string) string {
+		t.Helper()
+		decoder, err := newRecordDecoder(formatAvroOCF, bytes.NewReader(writeOCF(t, schema)))
+		if err != nil {
+			t.Fatalf("Expected an OCF decoder, but got %v", err)
+		}
+		return decoder.(*avroOCFDecoder).schemaFingerprint()
+	}
+
+	// 같은 스키마는 실행할 때마다 같은 값이어야 문서를 스키마별로 찾을 수 있습니다.
+	const expected = "f169c23a4ef7bc9c"
+	if got := fingerprint(testProductSchema); got != expected {
+		t.Errorf("Expected fingerprint %s, but got %s", expected, got)
+	}
+	// 공백과 doc은 Parsing Canonical Form에 들어가지 않습니다.
+	reformatted := `{"type":"record","name":"Product","doc":"상품 피드","fields":[` +
+		`{"name":"productId","type":["null","string"]},{"name":"title","type":"string"},` +
+		`{"name":"price","type":["null","string"]},{"name":"stock","type":["null","long"]}]}`
+	if got := fingerprint(reformatted); got != expected {
+		t.Errorf("Expected the same fingerprint for a reformatted schema, but got %s", got)
+	}
+	changed := strings.Replace(testProductSchema, `"name": "stock", "type": ["null", "long"]`, `"name": "stock", "type": ["null", "int"]`, 1)
+	if got := fingerprint(changed); got == expected {
+		t.Errorf("Expected a different fingerprint after changing a field type, but got %s", got)
+	}
+}
+
+func TestHandlerKeepsLargeJSONNumbers(t *testing.T) {
+	setenv(t, "VERSION_FIELD", "revision")
+	// float64로 읽으면 1234567890123456768, 9007199254740992가 됩니다.
+	body := `{"productId":1234567890123456789,"stock":9007199254740993,"revision":1700000000000000001}` + "\n"
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.ndjson": []byte(body)}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.ndjson")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.requests) != 1 {
+		t.Fatalf("Expected 1 bulk request, but got %d", len(recorder.requests))
+	}
+	sent := string(recorder.requests[0])
+	for _, expected := range []string{`"_id":"1234567890123456789"`, `"productId":1234567890123456789`,
+		`"stock":9007199254740993`, `"version":1700000000000000001`} {
+		if !strings.Contains(sent, expected) {
+			t.Errorf("Expected %s in the bulk body, but got %s", expected, sent)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var record map[string]interface{}
+	if err := unmarshalJSON([]byte(`{"productId": 1234567890123456789}`), &record); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if record["productId"] != json.Number("1234567890123456789") {
+		t.Errorf("Expected json.Number 1234567890123456789, but got %#v", record["productId"])
+	}
+	// json.Unmarshal과 같이 값 뒤의 내용은 거부합니다.
+	if err := unmarshalJSON([]byte(`{"productId": 1} {"productId": 2}`), &record); err == nil {
+		t.Errorf("Expected an error for trailing data, but got nil")
+	}
+}
+
+func TestHandlerReadsMixedFormats(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema, map[string]interface{}{
+		"productId": goavro.Union("string", "avro-1"),
+		"title":     "무선 이어폰",
+		"price":     goavro.Union("string", "19900"),
+		"stock":     nil,
+	})
+	ndjson := `{"productId":"json-1","title":"충전기","price":"9900"}
+{"productId":"json-2","title":"케이블","price":"3000"}
+`
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"feed-bucket/products.avro":   ocf,
+		"feed-bucket/products.ndjson": []byte(ndjson),
+	}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "products.avro", "products.ndjson")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	actions, docs := recorder.documents(t)
+	if len(docs) != 3 {
+		t.Fatalf("Expected 3 documents, but got %d", len(docs))
+	}
+	if id := actions[1]["index"].(map[string]interface{})["_id"]; id != "json-1" {
+		t.Errorf("Expected json-1 from the ndjson file, but got %v", id)
+	}
+	// JSON 레코드도 같은 정규화를 거칩니다.
+	if docs[1]["price"] != float64(9900) {
+		t.Errorf("Expected normalized price 9900, but got %v", docs[1]["price"])
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// deadLetter는 색인하지 못해 나중에 재처리해야 하는 레코드 하나입니다.
+type deadLetter struct {
+	ProductID    string                 `json:"productId"`
+	SourceBucket string                 `json:"sourceBucket"`
+	SourceKey    string                 `json:"sourceKey"`
+	Status       int                    `json:"status,omitempty"`
+	Error        string                 `json:"error"`
+	FailedAt     string                 `json:"failedAt"`
+	Record       map[string]interface{} `json:"record"`
+}
+
+// deadLetterSink는 DLQ_TARGET으로 지정된 곳에 실패한 레코드를 기록합니다.
+type deadLetterSink interface {
+	send(ctx context.Context, letters []deadLetter) error
+}
+
+// S3Putter는 S3 DLQ가 사용하는 S3 API입니다.
+type S3Putter interface {
+	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
+}
+
+// SQSSender는 SQS DLQ가 사용하는 SQS API입니다.
+type SQSSender interface {
+	SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error)
+}
+
+// newDeadLetterSink는 DLQ_TARGET 값으로 DLQ를 만듭니다. 값이 없으면 nil을 반환합니다.
+//   - s3://bucket/prefix : 실패한 레코드를 NDJSON 객체로 저장
+//   - https://sqs.<region>.amazonaws.com/<account>/<queue> : 레코드마다 메시지 하나
+func newDeadLetterSink(sess *session.Session, target string) (deadLetterSink, error) {
+	if target == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DLQ_TARGET %q: %w", target, err)
+	}
+	switch {
+	case u.Scheme == "s3" && u.Host != "":
+		return &s3DeadLetterSink{
+			client: s3.New(sess),
+			bucket: u.Host,
+			prefix: strings.Trim(u.Path, "/"),
+		}, nil
+	case u.Scheme == "https" && strings.HasPrefix(u.Host, "sqs."):
+		return &sqsDeadLetterSink{client: sqs.New(sess), queueURL: target}, nil
+	}
+	return nil, fmt.Errorf("invalid DLQ_TARGET %q: expected s3://bucket/prefix or an SQS queue URL", target)
+}
+
+// s3DeadLetterSink는 한 번에 받은 레코드를 NDJSON 객체 하나로 저장합니다.
+type s3DeadLetterSink struct {
+	client S3Putter
+	bucket string
+	prefix string
+}
+
+func (s *s3DeadLetterSink) send(ctx context.Context, letters []deadLetter) error {
+	var body bytes.Buffer
+	for _, letter := range letters {
+		line, err := json.Marshal(letter)
+		if err != nil {
+			return fmt.Errorf("error encoding dead letter for %s: %w", letter.ProductID, err)
+		}
+		body.Write(line)
+		body.WriteString("\n")
+	}
+
+	// <prefix>/<원본 버킷>/<원본 키>/<시각>.ndjson
+	first := letters[0]
+	key := path.Join(s.prefix, first.SourceBucket, first.SourceKey, strconv.FormatInt(time.Now().UnixNano(), 10)+".ndjson")
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("error writing dead letters to s3://%s/%s: %w", s.bucket, key, err)
+	}
+	return nil
+}
+
+// SendMessageBatch 한 번에 보낼 수 있는 최대 메시지 수
+const sqsMaxBatchEntries = 10
+
+// sqsDeadLetterSink는 레코드마다 SQS 메시지 하나를 보냅니다.
+type sqsDeadLetterSink struct {
+	client   SQSSender
+	queueURL string
+}
+
+func (s *sqsDeadLetterSink) send(ctx context.Context, letters []deadLetter) error {
+	for start := 0; start < len(letters); start += sqsMaxBatchEntries {
+		end := start + sqsMaxBatchEntries
+		if end > len(letters) {
+			end = len(letters)
+		}
+
+		var entries []*sqs.SendMessageBatchRequestEntry
+		for i, letter := range letters[start:end] {
+			body, err := json.Marshal(letter)
+			if err != nil {
+				return fmt.Errorf("error encoding dead letter for %s: %w", letter.ProductID, err)
+			}
+			entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(start + i)),
+				MessageBody: aws.String(string(body)),
+			})
+		}
+
+		out, err := s.client.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(s.queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return fmt.Errorf("error sending dead letters to %s: %w", s.queueURL, err)
+		}
+		if len(out.Failed) > 0 {
+			return fmt.Errorf("error sending %d dead letters to %s: %s", len(out.Failed), s.queueURL, aws.StringValue(out.Failed[0].Message))
+		}
+	}
+	return nil
+}
+
+// deadLetterInvalid는 검증 규칙을 통과하지 못한 레코드를 DLQ로 보냅니다. DLQ가 없으면 아무것도 하지 않습니다.
+func (h *handler) deadLetterInvalid(ctx context.Context, letters []deadLetter) error {
+	if h.dlq == nil || len(letters) == 0 {
+		return nil
+	}
+	if err := h.dlq.send(ctx, letters); err != nil {
+		return err
+	}
+	logger.Warn("invalid records sent to DLQ", "bucket", letters[0].SourceBucket, "key", letters[0].SourceKey, "count", len(letters))
+	return nil
+}
+
+// deadLetterRejected는 OpenSearch가 영구적으로 거부한 문서를 DLQ로 보냅니다.
+// DLQ에 기록한 문서는 처리된 것으로 보고, 재시도가 필요한 나머지 실패만 오류로 반환합니다.
+func (h *handler) deadLetterRejected(ctx context.Context, bucket, key string, err error) error {
+	var bulkErr *BulkItemsError
+	if h.dlq == nil || !errors.As(err, &bulkErr) {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var letters []deadLetter
+	var remaining []DocError
+	for _, failed := range bulkErr.Failed {
+		if !failed.permanent() {
+			remaining = append(remaining, failed)
+			continue
+		}
+		letters = append(letters, deadLetter{
+			ProductID:    failed.ID,
+			SourceBucket: bucket,
+			SourceKey:    key,
+			Status:       failed.Status,
+			Error:        failed.Type + ": " + failed.Reason,
+			FailedAt:     now,
+			Record:       failed.Record,
+		})
+	}
+	if len(letters) == 0 {
+		return err
+	}
+
+	if dlqErr := h.dlq.send(ctx, letters); dlqErr != nil {
+		return fmt.Errorf("%w (and %d rejected documents could not be dead-lettered: %v)", err, len(letters), dlqErr)
+	}
+	logger.Warn("rejected documents sent to DLQ", "bucket", bucket, "key", key, "count", len(letters))
+
+	var remainingErr error
+	if len(remaining) > 0 {
+		remainingErr = &BulkItemsError{Total: bulkErr.Total, Failed: remaining}
+	}
+	// 여러 요청으로 나눠 보낸 배치는 다른 요청의 오류와 합쳐져 있으므로 그 오류는 그대로 둡니다.
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			if e == error(bulkErr) {
+				e = remainingErr
+			}
+			if e != nil {
+				errs = append(errs, e)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return remainingErr
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/linkedin/goavro/v2"
+)
+
+// fakeS3Putter는 PutObject로 받은 객체를 메모리에 보관합니다.
+type fakeS3Putter struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3Putter) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	body, _ := io.ReadAll(input.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.objects == nil {
+		f.objects = map[string][]byte{}
+	}
+	f.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+// fakeSQS는 SendMessageBatch로 받은 메시지 본문을 보관합니다.
+type fakeSQS struct {
+	messages []string
+}
+
+func (f *fakeSQS) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	for _, entry := range input.Entries {
+		f.messages = append(f.messages, aws.StringValue(entry.MessageBody))
+	}
+	return &sqs.SendMessageBatchOutput{}, nil
+}
+
+func TestNewDeadLetterSink(t *testing.T) {
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion("ap-northeast-2")))
+
+	testCases := []struct {
+		name        string
+		target      string
+		expectError bool
+		check       func(t *testing.T, sink deadLetterSink)
+	}{
+		{
+			name:   "unset",
+			target: "",
+			check: func(t *testing.T, sink deadLetterSink) {
+				if sink != nil {
+					t.Errorf("Expected no sink, but got %T", sink)
+				}
+			},
+		},
+		{
+			name:   "s3 prefix",
+			target: "s3://dlq-bucket/failed/products/",
+			check: func(t *testing.T, sink deadLetterSink) {
+				s3Sink, ok := sink.(*s3DeadLetterSink)
+				if !ok || s3Sink.bucket != "dlq-bucket" || s3Sink.prefix != "failed/products" {
+					t.Errorf("Expected s3 sink for dlq-bucket/failed/products, but got %+v", sink)
+				}
+			},
+		},
+		{
+			name:   "sqs queue",
+			target: "https://sqs.ap-northeast-2.amazonaws.com/123456789012/products-dlq",
+			check: func(t *testing.T, sink deadLetterSink) {
+				if _, ok := sink.(*sqsDeadLetterSink); !ok {
+					t.Errorf("Expected sqs sink, but got %T", sink)
+				}
+			},
+		},
+		{
+			name:        "unsupported target",
+			target:      "ftp://example.com/dlq",
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			sink, err := newDeadLetterSink(sess, testCase.target)
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error %v, but got %v", testCase.expectError, err)
+			}
+			if testCase.check != nil {
+				testCase.check(t, sink)
+			}
+		})
+	}
+}
+
+func TestHandlerDeadLettersRejectedDocuments(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema,
+		map[string]interface{}{"productId": goavro.Union("string", "p1"), "title": "ok", "price": nil, "stock": nil},
+		map[string]interface{}{"productId": goavro.Union("string", "p2"), "title": "bad", "price": goavro.Union("string", "N/A"), "stock": nil},
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errors":true,"items":[
+			{"index":{"_id":"p1","status":201}},
+			{"index":{"_id":"p2","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [price]"}}}
+		]}`))
+	}))
+	defer server.Close()
+
+	testCases := []struct {
+		name string
+		sink func() (deadLetterSink, func(t *testing.T) []deadLetter)
+	}{
+		{
+			name: "s3",
+			sink: func() (deadLetterSink, func(t *testing.T) []deadLetter) {
+				putter := &fakeS3Putter{}
+				return &s3DeadLetterSink{client: putter, bucket: "dlq-bucket", prefix: "failed"}, func(t *testing.T) []deadLetter {
+					var letters []deadLetter
+					for _, body := range putter.objects {
+						for _, line := range bytes.Split(bytes.TrimSpace(body), []byte("\n")) {
+							var letter deadLetter
+							json.Unmarshal(line, &letter)
+							letters = append(letters, letter)
+						}
+					}
+					return letters
+				}
+			},
+		},
+		{
+			name: "sqs",
+			sink: func() (deadLetterSink, func(t *testing.T) []deadLetter) {
+				queue := &fakeSQS{}
+				return &sqsDeadLetterSink{client: queue, queueURL: "https://sqs.ap-northeast-2.amazonaws.com/1/dlq"}, func(t *testing.T) []deadLetter {
+					var letters []deadLetter
+					for _, message := range queue.messages {
+						var letter deadLetter
+						json.Unmarshal([]byte(message), &letter)
+						letters = append(letters, letter)
+					}
+					return letters
+				}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			sink, written := testCase.sink()
+			h := &handler{
+				config:     testConfig(t),
+				s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+				openSearch: testClient(t, server.URL),
+				dlq:        sink,
+			}
+			if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+				t.Fatalf("Expected dead-lettered failures not to fail the invocation, but got %v", err)
+			}
+
+			letters := written(t)
+			if len(letters) != 1 {
+				t.Fatalf("Expected 1 dead letter, but got %d", len(letters))
+			}
+			letter := letters[0]
+			if letter.ProductID != "p2" || letter.SourceBucket != "feed-bucket" || letter.SourceKey != "feed.avro" {
+				t.Errorf("Expected p2 from feed-bucket/feed.avro, but got %+v", letter)
+			}
+			if letter.Error != "mapper_parsing_exception: failed to parse field [price]" {
+				t.Errorf("Expected OpenSearch error message, but got %q", letter.Error)
+			}
+			if letter.Record["price"] != "N/A" {
+				t.Errorf("Expected original record, but got %v", letter.Record)
+			}
+		})
+	}
+}
+
+func TestHandlerDeadLettersInvalidRecords(t *testing.T) {
+	setenv(t, "VALIDATION_CONFIG", `{"required":["productId"],"ranges":{"price":{"min":0}}}`)
+	ocf := writeOCF(t, testProductSchema,
+		map[string]interface{}{"productId": goavro.Union("string", "p1"), "title": "ok", "price": goavro.Union("string", "100"), "stock": nil},
+		map[string]interface{}{"productId": goavro.Union("string", "p2"), "title": "negative", "price": goavro.Union("string", "-1"), "stock": nil},
+		map[string]interface{}{"productId": nil, "title": "no id", "price": nil, "stock": nil},
+	)
+	recorder := newBulkRecorder(t)
+	queue := &fakeSQS{}
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+		openSearch: testClient(t, recorder.URL),
+		dlq:        &sqsDeadLetterSink{client: queue, queueURL: "https://sqs.ap-northeast-2.amazonaws.com/1/dlq"},
+	}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	_, docs := recorder.documents(t)
+	if len(docs) != 1 || docs[0]["productId"] != "p1" {
+		t.Errorf("Expected only p1 to be indexed, but got %v", docs)
+	}
+	if summary.RecordsInvalid != 2 || summary.Files["feed-bucket/feed.avro"].RecordsInvalid != 2 {
+		t.Errorf("Expected 2 invalid records in the summary, but got %+v", summary)
+	}
+	if len(queue.messages) != 2 {
+		t.Fatalf("Expected 2 dead letters, but got %d", len(queue.messages))
+	}
+	var letter deadLetter
+	json.Unmarshal([]byte(queue.messages[0]), &letter)
+	if letter.ProductID != "p2" || letter.SourceKey != "feed.avro" || letter.Record["title"] != "negative" ||
+		letter.Error != `validation_failed: field "price" is -1, below the minimum 0` {
+		t.Errorf("Expected a dead letter for p2 with the reason, but got %+v", letter)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// 보강 테이블의 조인 키 필드와 결과를 넣을 필드
+const (
+	enrichmentJoinField   = "productId"
+	enrichmentTargetField = "categoryLabel"
+)
+
+// enrichmentTable은 productId → 카테고리 라벨 매핑입니다. 컨테이너당 한 번 S3에서 읽습니다.
+type enrichmentTable struct {
+	labels map[string]string
+}
+
+// parseEnrichmentURI는 ENRICHMENT_S3_URI(s3://bucket/key.json 또는 .csv)를 읽습니다.
+func parseEnrichmentURI(value string) (objectRef, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme != "s3" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return objectRef{}, fmt.Errorf("invalid ENRICHMENT_S3_URI %q (expected s3://bucket/key)", value)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	switch strings.ToLower(path.Ext(key)) {
+	case ".json", ".csv":
+		return objectRef{bucket: u.Host, key: key}, nil
+	}
+	return objectRef{}, fmt.Errorf("invalid ENRICHMENT_S3_URI %q (expected a .json or .csv object)", value)
+}
+
+// loadEnrichment는 ENRICHMENT_S3_URI의 매핑을 읽습니다. 값이 없으면 nil을 반환합니다.
+func (h *handler) loadEnrichment(ctx context.Context, uri string) (*enrichmentTable, error) {
+	if uri == "" {
+		return nil, nil
+	}
+	object, err := parseEnrichmentURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.getObject(ctx, object)
+	if err != nil {
+		return nil, fmt.Errorf("error getting enrichment table %s: %w", uri, err)
+	}
+	if result.Body == nil {
+		return nil, fmt.Errorf("error getting enrichment table %s: response has no body", uri)
+	}
+	defer result.Body.Close()
+
+	var labels map[string]string
+	if strings.EqualFold(path.Ext(object.key), ".csv") {
+		labels, err = parseEnrichmentCSV(result.Body)
+	} else {
+		labels, err = parseEnrichmentJSON(result.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading enrichment table %s: %w", uri, err)
+	}
+	logger.Info("loaded enrichment table", "uri", uri, "entries", len(labels))
+	return &enrichmentTable{labels: labels}, nil
+}
+
+// parseEnrichmentJSON은 {"<productId>": "<label>", ...} 형태의 객체를 읽습니다.
+func parseEnrichmentJSON(r io.Reader) (map[string]string, error) {
+	var labels map[string]string
+	if err := json.NewDecoder(r).Decode(&labels); err != nil {
+		return nil, fmt.Errorf("expected a JSON object of productId to label: %w", err)
+	}
+	return labels, nil
+}
+
+// parseEnrichmentCSV는 첫 줄을 헤더로 보고 나머지 줄의 첫 두 열을 productId, 라벨로 읽습니다.
+func parseEnrichmentCSV(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	if _, err := reader.Read(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("CSV has no header row")
+		}
+		return nil, err
+	}
+	labels := make(map[string]string)
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return labels, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row) < 2 {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: expected productId,label columns", line)
+		}
+		labels[row[0]] = row[1]
+	}
+}
+
+// enrich는 productId에 맞는 라벨을 categoryLabel에 넣습니다. 매핑에 없으면 필드를 넣지 않습니다.
+func (t *enrichmentTable) enrich(raw map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	id, ok := documentID(raw[enrichmentJoinField])
+	if !ok {
+		return
+	}
+	if label, ok := t.labels[id]; ok {
+		raw[enrichmentTargetField] = label
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnrichmentURI(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected objectRef
+		err      string
+	}{
+		{name: "json object", value: "s3://lookup-bucket/tables/categories.json", expected: objectRef{bucket: "lookup-bucket", key: "tables/categories.json"}},
+		{name: "csv object", value: "s3://lookup-bucket/categories.CSV", expected: objectRef{bucket: "lookup-bucket", key: "categories.CSV"}},
+		{name: "missing key", value: "s3://lookup-bucket/", err: "expected s3://bucket/key"},
+		{name: "not s3", value: "https://example.com/categories.json", err: "expected s3://bucket/key"},
+		{name: "unsupported extension", value: "s3://lookup-bucket/categories.parquet", err: "expected a .json or .csv object"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			object, err := parseEnrichmentURI(testCase.value)
+			if testCase.err != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.err) {
+					t.Fatalf("Expected error containing %q, but got %v", testCase.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if object != testCase.expected {
+				t.Errorf("Expected %+v, but got %+v", testCase.expected, object)
+			}
+		})
+	}
+}
+
+func TestLoadEnrichment(t *testing.T) {
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"lookup-bucket/categories.json": []byte(`{"p1": "Beauty", "p2": "Food"}`),
+		"lookup-bucket/categories.csv":  []byte("productId,label\np1,Beauty\np2,\"Food, Snacks\"\n"),
+		"lookup-bucket/header.csv":      []byte(""),
+		"lookup-bucket/short.csv":       []byte("productId,label\np1\n"),
+		"lookup-bucket/array.json":      []byte(`["p1", "Beauty"]`),
+	}}
+	h := &handler{config: testConfig(t), s3: s3Client}
+
+	testCases := []struct {
+		name     string
+		uri      string
+		expected map[string]string
+		err      string
+	}{
+		{name: "json", uri: "s3://lookup-bucket/categories.json", expected: map[string]string{"p1": "Beauty", "p2": "Food"}},
+		{name: "csv", uri: "s3://lookup-bucket/categories.csv", expected: map[string]string{"p1": "Beauty", "p2": "Food, Snacks"}},
+		{name: "empty csv", uri: "s3://lookup-bucket/header.csv", err: "CSV has no header row"},
+		{name: "missing label column", uri: "s3://lookup-bucket/short.csv", err: "line 2: expected productId,label columns"},
+		{name: "json array", uri: "s3://lookup-bucket/array.json", err: "expected a JSON object"},
+		{name: "missing object", uri: "s3://lookup-bucket/absent.json", err: "error getting enrichment table"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			table, err := h.loadEnrichment(context.Background(), testCase.uri)
+			if testCase.err != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.err) {
+					t.Fatalf("Expected error containing %q, but got %v", testCase.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(table.labels, testCase.expected) {
+				t.Errorf("Expected %v, but got %v", testCase.expected, table.labels)
+			}
+		})
+	}
+
+	table, err := h.loadEnrichment(context.Background(), "")
+	if table != nil || err != nil {
+		t.Errorf("Expected no table without ENRICHMENT_S3_URI, but got %v, %v", table, err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// scannedRecord는 decoder에서 읽은 레코드 하나입니다.
+type scannedRecord struct {
+	datum map[string]interface{}
+	err   error
+	// 리더가 더 읽을 수 없게 된 오류(손상된 블록 등)인지 여부. decoder.Err()에서 자세한 오류를 확인합니다.
+	fatal bool
+}
+
+// scanNext는 decoder에서 다음 레코드를 읽습니다. 더 읽을 레코드가 없으면 false를 반환합니다.
+func scanNext(decoder RecordDecoder) (scannedRecord, bool) {
+	if !decoder.Scan() {
+		return scannedRecord{}, false
+	}
+	datum, err := decoder.Record()
+	return scannedRecord{datum: datum, err: err, fatal: err != nil && decoder.Err() != nil}, true
+}
+
+// scanRecords는 decoder를 별도 고루틴에서 읽어 채널로 넘깁니다.
+// 레코드가 드문드문 들어오는 스트리밍 입력에서 읽기를 기다리는 동안에도 FLUSH_INTERVAL로 배치를 보낼 수 있게 합니다.
+// done이 닫히면 더 넘기지 않고, 고루틴이 끝나면 채널을 닫습니다. 읽기에 막혀 있으면 입력을 닫아야 끝납니다.
+func scanRecords(decoder RecordDecoder, done <-chan struct{}) <-chan scannedRecord {
+	records := make(chan scannedRecord)
+	go func() {
+		defer close(records)
+		for {
+			scanned, ok := scanNext(decoder)
+			if !ok {
+				return
+			}
+			select {
+			case records <- scanned:
+			case <-done:
+				return
+			}
+			if scanned.fatal {
+				return
+			}
+		}
+	}()
+	return records
+}
+
+// parseFlushInterval은 FLUSH_INTERVAL("5s", "500ms" 등)을 읽습니다. 값이 없거나 0이면 시간으로 보내지 않습니다.
+func parseFlushInterval(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid FLUSH_INTERVAL %q (expected a non-negative duration such as 5s)", value)
+	}
+	return interval, nil
+}
+
+// flushIntervalFromEnv는 FLUSH_INTERVAL을 읽습니다. 잘못된 값은 validateConfig가 시작할 때 막습니다.
+func flushIntervalFromEnv() time.Duration {
+	interval, err := parseFlushInterval(os.Getenv("FLUSH_INTERVAL"))
+	if err != nil {
+		logger.Warn("batches are not flushed on a timer", "error", err)
+		return 0
+	}
+	return interval
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// MAX_FIELD_BYTES를 넘는 문자열 필드를 처리하는 방법 (OVERSIZED_FIELD_ACTION)
+const (
+	oversizedTruncate = "truncate"
+	oversizedDrop     = "drop"
+)
+
+// parseOversizedFieldAction은 OVERSIZED_FIELD_ACTION을 읽습니다. 값이 없으면 잘라냅니다.
+func parseOversizedFieldAction(value string) (string, error) {
+	switch value {
+	case "":
+		return oversizedTruncate, nil
+	case oversizedTruncate, oversizedDrop:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown OVERSIZED_FIELD_ACTION %q (expected %q or %q)", value, oversizedTruncate, oversizedDrop)
+}
+
+// oversizedFieldActionFromEnv는 OVERSIZED_FIELD_ACTION을 읽습니다. 잘못된 값은 validateConfig가 시작할 때 막습니다.
+func oversizedFieldActionFromEnv() string {
+	action, err := parseOversizedFieldAction(os.Getenv("OVERSIZED_FIELD_ACTION"))
+	if err != nil {
+		logger.Warn("oversized fields are truncated", "error", err)
+		return oversizedTruncate
+	}
+	return action
+}
+
+// limitFieldSizes는 maxBytes를 넘는 문자열 값을 잘라내거나 뺍니다. 중첩 레코드와 배열 안의 문자열도 검사합니다.
+// 배열 원소는 빼면 순서가 바뀌므로 drop이어도 빈 문자열로 남깁니다.
+func limitFieldSizes(raw map[string]interface{}, maxBytes int, action string) {
+	if maxBytes <= 0 {
+		return
+	}
+	for key, value := range raw {
+		limited, keep := limitValueSize(key, value, maxBytes, action)
+		if keep {
+			raw[key] = limited
+		} else {
+			delete(raw, key)
+		}
+	}
+}
+
+// limitValueSize는 path 위치의 값을 검사해 바뀐 값과 필드를 남길지 여부를 반환합니다.
+func limitValueSize(path string, value interface{}, maxBytes int, action string) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if len(v) <= maxBytes {
+			return v, true
+		}
+		logger.Warn("oversized field", "field", path, "bytes", len(v), "max_bytes", maxBytes, "action", action)
+		if action == oversizedDrop {
+			return nil, false
+		}
+		return truncateUTF8(v, maxBytes), true
+	case map[string]interface{}:
+		for key, nested := range v {
+			limited, keep := limitValueSize(path+"."+key, nested, maxBytes, action)
+			if keep {
+				v[key] = limited
+			} else {
+				delete(v, key)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			limited, keep := limitValueSize(fmt.Sprintf("%s[%d]", path, i), item, maxBytes, action)
+			if !keep {
+				limited = ""
+			}
+			v[i] = limited
+		}
+	}
+	return value, true
+}
+
+// truncateUTF8은 s를 maxBytes 이하로 자릅니다. 멀티바이트 문자 중간에서 자르지 않습니다.
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	n := maxBytes
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
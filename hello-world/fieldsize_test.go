@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		maxBytes int
+		expected string
+	}{
+		{name: "short value", value: "abc", maxBytes: 5, expected: "abc"},
+		{name: "ascii", value: "abcdef", maxBytes: 4, expected: "abcd"},
+		// "가"는 3바이트이므로 4바이트에서 자르면 두 번째 글자가 잘리지 않고 빠집니다.
+		{name: "does not split a rune", value: "가나다", maxBytes: 4, expected: "가"},
+		{name: "rune boundary", value: "가나다", maxBytes: 6, expected: "가나"},
+		{name: "first rune too long", value: "가", maxBytes: 2, expected: ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			truncated := truncateUTF8(testCase.value, testCase.maxBytes)
+			if truncated != testCase.expected {
+				t.Errorf("Expected %q, but got %q", testCase.expected, truncated)
+			}
+			if !utf8.ValidString(truncated) {
+				t.Errorf("Expected valid UTF-8, but got %q", truncated)
+			}
+		})
+	}
+}
+
+func TestLimitFieldSizes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		action   string
+		expected map[string]interface{}
+	}{
+		{
+			name:   "truncate",
+			action: oversizedTruncate,
+			expected: map[string]interface{}{
+				"productId":   "p1",
+				"description": "abcd",
+				"stock":       int64(123456789),
+				"seller":      map[string]interface{}{"name": "abcd"},
+				"tags":        []interface{}{"ok", "abcd"},
+			},
+		},
+		{
+			name:   "drop",
+			action: oversizedDrop,
+			expected: map[string]interface{}{
+				"productId": "p1",
+				"stock":     int64(123456789),
+				"seller":    map[string]interface{}{},
+				// 배열 원소는 순서를 지키기 위해 빈 문자열로 남습니다.
+				"tags": []interface{}{"ok", ""},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"productId":   "p1",
+				"description": "abcdefgh",
+				"stock":       int64(123456789),
+				"seller":      map[string]interface{}{"name": "abcdefgh"},
+				"tags":        []interface{}{"ok", "abcdefgh"},
+			}
+			limitFieldSizes(raw, 4, testCase.action)
+			if !reflect.DeepEqual(raw, testCase.expected) {
+				t.Errorf("Expected %v, but got %v", testCase.expected, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/opensearch-project/opensearch-go/v2"
+)
+
+// checkOpenSearch는 콜드 스타트 때 클러스터 상태와 대상 인덱스를 확인합니다.
+// 엔드포인트나 인증이 잘못되었거나 클러스터가 red이면 배치마다 같은 오류로 실패하므로 미리 알립니다.
+// 배치와 같은 클라이언트를 쓰므로 인증/TLS 설정도 함께 확인됩니다.
+func checkOpenSearch(ctx context.Context, client *opensearch.Client, indexNames indexNamer) error {
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := getJSON(ctx, client, "/_cluster/health", &health); err != nil {
+		return fmt.Errorf("OpenSearch health check failed: %w", err)
+	}
+	if health.Status == "red" {
+		return fmt.Errorf("OpenSearch health check failed: cluster status is red")
+	}
+
+	// 날짜 접미사를 쓰면 인덱스는 첫 문서가 들어올 때 만들어지므로 확인하지 않습니다.
+	if indexNames.dateSuffix {
+		logger.Info("OpenSearch health check passed", "cluster_status", health.Status)
+		return nil
+	}
+	exists, err := indexExists(ctx, client, indexNames.base)
+	if err != nil {
+		return fmt.Errorf("OpenSearch health check failed: %w", err)
+	}
+	if !exists {
+		autoCreate, err := autoCreateIndexEnabled(ctx, client)
+		if err != nil {
+			return fmt.Errorf("OpenSearch health check failed: %w", err)
+		}
+		if !autoCreate {
+			return fmt.Errorf("OpenSearch health check failed: index %q does not exist and action.auto_create_index is disabled", indexNames.base)
+		}
+		logger.Warn("target index does not exist yet, it will be auto-created", "index", indexNames.base)
+	}
+	logger.Info("OpenSearch health check passed", "cluster_status", health.Status, "index", indexNames.base)
+	return nil
+}
+
+// indexExists는 HEAD /<index>로 인덱스(또는 별칭)가 있는지 확인합니다.
+func indexExists(ctx context.Context, client *opensearch.Client, index string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", "/"+url.PathEscape(index), nil)
+	if err != nil {
+		return false, fmt.Errorf("error creating index request: %v", err)
+	}
+	resp, err := client.Perform(req)
+	if err != nil {
+		return false, fmt.Errorf("error checking index %q: %w", index, err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("error checking index %q: %v", index, resp.Status)
+}
+
+// autoCreateIndexEnabled는 클러스터 설정의 action.auto_create_index를 확인합니다.
+// "false"일 때만 꺼진 것으로 보고, 패턴 목록("+products*,-*")은 켜진 것으로 봅니다.
+func autoCreateIndexEnabled(ctx context.Context, client *opensearch.Client) (bool, error) {
+	var settings map[string]map[string]interface{}
+	path := "/_cluster/settings?include_defaults=true&flat_settings=true&filter_path=*.action.auto_create_index"
+	if err := getJSON(ctx, client, path, &settings); err != nil {
+		return false, err
+	}
+	// transient, persistent, defaults 순서로 우선합니다.
+	for _, level := range []string{"transient", "persistent", "defaults"} {
+		if value, ok := settings[level]["action.auto_create_index"]; ok {
+			return fmt.Sprint(value) != "false", nil
+		}
+	}
+	return true, nil
+}
+
+// getJSON은 GET 요청의 JSON 응답을 out에 디코딩합니다.
+func getJSON(ctx context.Context, client *opensearch.Client, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Perform(req)
+	if err != nil {
+		return fmt.Errorf("error sending GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error response from OpenSearch for GET %s: %v", path, resp.Status)
+	}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("error decoding response for GET %s: %v", path, err)
+	}
+	return nil
+}
+
+// checkWriteAlias는 INDEX_IS_ALIAS일 때 GET /_alias/<name>으로 대상이 쓰기 가능한 별칭인지 확인하고
+// 문서가 들어갈 backing 인덱스를 반환합니다. 읽기 전용 별칭에 색인하면 배치마다 실패하므로 시작할 때 막습니다.
+// 별칭이 backing 인덱스 하나를 가리키면 is_write_index가 false가 아닌 한 쓰기 인덱스이고,
+// 여러 개를 가리키면 is_write_index가 true인 인덱스가 정확히 하나 있어야 합니다.
+func checkWriteAlias(ctx context.Context, client *opensearch.Client, alias string) (string, error) {
+	path := "/_alias/" + url.PathEscape(alias)
+	req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating alias request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Perform(req)
+	if err != nil {
+		return "", fmt.Errorf("OpenSearch alias check failed: error sending GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("OpenSearch alias check failed: alias %q does not exist", alias)
+	default:
+		return "", fmt.Errorf("OpenSearch alias check failed: error response from OpenSearch for GET %s: %v", path, resp.Status)
+	}
+
+	// {"<backing index>": {"aliases": {"<alias>": {"is_write_index": true}}}}
+	var indices map[string]struct {
+		Aliases map[string]struct {
+			IsWriteIndex *bool `json:"is_write_index"`
+		} `json:"aliases"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&indices); err != nil {
+		return "", fmt.Errorf("OpenSearch alias check failed: error decoding response for GET %s: %v", path, err)
+	}
+	var writeIndices []string
+	for index, entry := range indices {
+		settings, ok := entry.Aliases[alias]
+		if !ok {
+			continue
+		}
+		explicit := settings.IsWriteIndex != nil && *settings.IsWriteIndex
+		implicit := settings.IsWriteIndex == nil && len(indices) == 1
+		if explicit || implicit {
+			writeIndices = append(writeIndices, index)
+		}
+	}
+	if len(writeIndices) != 1 {
+		return "", fmt.Errorf("OpenSearch alias check failed: alias %q has no write index", alias)
+	}
+	logger.Info("OpenSearch write alias resolved", "alias", alias, "write_index", writeIndices[0])
+	return writeIndices[0], nil
+}
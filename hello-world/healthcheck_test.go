@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckOpenSearch(t *testing.T) {
+	testCases := []struct {
+		name       string
+		health     int
+		status     string
+		index      int
+		autoCreate string
+		dateSuffix bool
+		expected   string
+	}{
+		{name: "green with index", health: 200, status: "green", index: 200},
+		{name: "yellow is accepted", health: 200, status: "yellow", index: 200},
+		{name: "red cluster", health: 200, status: "red", index: 200, expected: "cluster status is red"},
+		{name: "unauthorized", health: 401, expected: "401 Unauthorized"},
+		{name: "missing index with auto-create", health: 200, status: "green", index: 404, autoCreate: `{"defaults":{"action.auto_create_index":"true"}}`},
+		{name: "missing index with auto-create disabled", health: 200, status: "green", index: 404,
+			autoCreate: `{"persistent":{"action.auto_create_index":"false"},"defaults":{"action.auto_create_index":"true"}}`,
+			expected:   `index "products" does not exist and action.auto_create_index is disabled`},
+		{name: "dated indices are not checked", health: 200, status: "green", index: 500, dateSuffix: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/_cluster/health":
+					w.WriteHeader(testCase.health)
+					w.Write([]byte(`{"status":"` + testCase.status + `"}`))
+				case r.URL.Path == "/_cluster/settings":
+					w.Write([]byte(testCase.autoCreate))
+				case r.Method == "HEAD" && r.URL.Path == "/products":
+					w.WriteHeader(testCase.index)
+				default:
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+				}
+			}))
+			defer server.Close()
+
+			err := checkOpenSearch(context.Background(), testClient(t, server.URL), indexNamer{base: "products", dateSuffix: testCase.dateSuffix})
+			if testCase.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckWriteAlias(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        int
+		body          string
+		expectedIndex string
+		expected      string
+	}{
+		{name: "single backing index", status: 200, body: `{"products-000001":{"aliases":{"products-write":{}}}}`, expectedIndex: "products-000001"},
+		{name: "rollover write index", status: 200,
+			body:          `{"products-000001":{"aliases":{"products-write":{"is_write_index":false}}},"products-000002":{"aliases":{"products-write":{"is_write_index":true}}}}`,
+			expectedIndex: "products-000002"},
+		{name: "read alias over several indices", status: 200,
+			body:     `{"products-000001":{"aliases":{"products-write":{}}},"products-000002":{"aliases":{"products-write":{}}}}`,
+			expected: `alias "products-write" has no write index`},
+		{name: "write index disabled", status: 200, body: `{"products-000001":{"aliases":{"products-write":{"is_write_index":false}}}}`,
+			expected: `alias "products-write" has no write index`},
+		{name: "missing alias", status: 404, body: `{"error":"alias [products-write] missing","status":404}`, expected: `alias "products-write" does not exist`},
+		{name: "unauthorized", status: 401, expected: "401 Unauthorized"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "GET" || r.URL.Path != "/_alias/products-write" {
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+				}
+				w.WriteHeader(testCase.status)
+				w.Write([]byte(testCase.body))
+			}))
+			defer server.Close()
+
+			index, err := checkWriteAlias(context.Background(), testClient(t, server.URL), "products-write")
+			if testCase.expected == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, but got %v", err)
+				}
+				if index != testCase.expectedIndex {
+					t.Errorf("Expected write index %q, but got %q", testCase.expectedIndex, index)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
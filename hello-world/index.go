@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/opensearch-project/opensearch-go/v2"
+)
+
+// INDEX_MAPPING_FILE이 없을 때 사용하는 기본 매핑.
+// 숫자 문자열로 들어오는 price, webcastSalesMoney 등을 숫자 타입으로 고정합니다.
+//
+//go:embed index_mapping.json
+var defaultIndexMapping []byte
+
+// indexMappingFromEnv는 INDEX_MAPPING_FILE의 인덱스 설정(JSON)을 읽습니다. 없으면 기본 매핑을 사용합니다.
+func indexMappingFromEnv() ([]byte, error) {
+	path := os.Getenv("INDEX_MAPPING_FILE")
+	if path == "" {
+		return defaultIndexMapping, nil
+	}
+	mapping, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading INDEX_MAPPING_FILE: %w", err)
+	}
+	if !json.Valid(mapping) {
+		return nil, fmt.Errorf("INDEX_MAPPING_FILE %q is not valid JSON", path)
+	}
+	return mapping, nil
+}
+
+// bootstrapIndex는 CREATE_INDEX일 때 대상 인덱스를 매핑과 함께 만듭니다.
+// 날짜 접미사를 쓰는 인덱스는 날마다 이름이 바뀌므로 만들지 않습니다. (인덱스 템플릿 사용)
+func bootstrapIndex(ctx context.Context, client *opensearch.Client, indexNames indexNamer) error {
+	if indexNames.dateSuffix {
+		logger.Warn("CREATE_INDEX is ignored with INDEX_DATE_SUFFIX, use an index template for dated indices", "index", indexNames.base)
+		return nil
+	}
+	mapping, err := indexMappingFromEnv()
+	if err != nil {
+		return err
+	}
+	return createIndex(ctx, client, indexNames.base, mapping)
+}
+
+// createIndex는 매핑과 함께 인덱스를 만듭니다. 이미 있으면 그대로 둡니다.
+func createIndex(ctx context.Context, client *opensearch.Client, index string, mapping []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", "/"+url.PathEscape(index), bytes.NewReader(mapping))
+	if err != nil {
+		return fmt.Errorf("error creating index request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Perform(req)
+	if err != nil {
+		return fmt.Errorf("error creating index %q: %w", index, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		logger.Info("index created", "index", index)
+		return nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	var errResp struct {
+		Error struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &errResp)
+	// 다른 컨테이너가 먼저 만들었거나 이미 운영 중인 인덱스
+	if errResp.Error.Type == "resource_already_exists_exception" {
+		logger.Debug("index already exists", "index", index)
+		return nil
+	}
+	if errResp.Error.Type != "" {
+		return fmt.Errorf("error creating index %q: %v: %s: %s", index, resp.Status, errResp.Error.Type, errResp.Error.Reason)
+	}
+	return fmt.Errorf("error creating index %q: %v", index, resp.Status)
+}
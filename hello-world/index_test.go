@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateIndex(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		response string
+		expected string
+	}{
+		{name: "created", status: 200, response: `{"acknowledged":true}`},
+		{name: "already exists", status: 400, response: `{"error":{"type":"resource_already_exists_exception","reason":"index [products/abc] already exists"},"status":400}`},
+		{name: "invalid mapping", status: 400, response: `{"error":{"type":"mapper_parsing_exception","reason":"no handler for type [number]"},"status":400}`,
+			expected: "mapper_parsing_exception: no handler for type [number]"},
+		{name: "forbidden", status: 403, response: ``, expected: "403 Forbidden"},
+	}
+
+	mapping := []byte(`{"mappings":{"properties":{"price":{"type":"double"}}}}`)
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.Method != "PUT" || r.URL.Path != "/products" || !bytes.Equal(body, mapping) {
+					t.Errorf("Expected PUT /products with the mapping, but got %s %s %s", r.Method, r.URL.Path, body)
+				}
+				w.WriteHeader(testCase.status)
+				w.Write([]byte(testCase.response))
+			}))
+			defer server.Close()
+
+			err := createIndex(context.Background(), testClient(t, server.URL), "products", mapping)
+			if testCase.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func TestIndexMappingFromEnv(t *testing.T) {
+	setenv(t, "INDEX_MAPPING_FILE", "")
+	mapping, err := indexMappingFromEnv()
+	if err != nil {
+		t.Fatalf("Expected the default mapping, but got %v", err)
+	}
+	// 기본 매핑은 숫자 문자열로 들어오는 필드를 숫자 타입으로 고정해야 합니다.
+	var parsed struct {
+		Mappings struct {
+			Properties map[string]struct {
+				Type string `json:"type"`
+			} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(mapping, &parsed); err != nil {
+		t.Fatalf("Expected valid default mapping JSON, but got %v", err)
+	}
+	for _, field := range defaultNumericFields {
+		if fieldType := parsed.Mappings.Properties[field].Type; fieldType != "double" && fieldType != "long" {
+			t.Errorf("Expected %s to be numeric, but got %q", field, fieldType)
+		}
+	}
+
+	dir := t.TempDir()
+	custom := filepath.Join(dir, "mapping.json")
+	os.WriteFile(custom, []byte(`{"mappings":{}}`), 0o600)
+	setenv(t, "INDEX_MAPPING_FILE", custom)
+	if mapping, err := indexMappingFromEnv(); err != nil || string(mapping) != `{"mappings":{}}` {
+		t.Errorf("Expected the custom mapping, but got %s (%v)", mapping, err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	os.WriteFile(invalid, []byte(`{"mappings":`), 0o600)
+	setenv(t, "INDEX_MAPPING_FILE", invalid)
+	if _, err := indexMappingFromEnv(); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("Expected an invalid JSON error, but got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// indexJob은 워커가 색인할 배치 하나입니다.
+type indexJob struct {
+	bucket string
+	key    string
+	batch  []interface{}
+	// 파일 안에서 몇 번째 배치인지 (0부터)
+	seq int
+}
+
+// indexPool은 가득 찬 배치를 최대 concurrency개의 워커가 동시에 색인합니다.
+// 채널에 버퍼가 없으므로 워커가 모두 바쁘면 submit이 기다리게 되어
+// 메모리에 쌓이는 배치 수가 워커 수만큼으로 제한됩니다.
+type indexPool struct {
+	jobs    chan indexJob
+	index   indexOptions
+	wg      sync.WaitGroup
+	metrics invocationMetrics
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// startIndexPool은 워커를 띄우고 배치를 받을 준비가 된 indexPool을 반환합니다. 워커는 모두 opts로 색인합니다.
+func (h *handler) startIndexPool(ctx context.Context, concurrency int, opts indexOptions) *indexPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	p := &indexPool{jobs: make(chan indexJob), index: opts}
+	for i := 0; i < concurrency; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				start := time.Now()
+				result, err := h.indexBatch(ctx, job, opts)
+				p.metrics.batchIndexed(job.bucket, job.key, time.Since(start))
+				p.metrics.record(job.bucket, job.key, result.bulkStats)
+				p.metrics.fileFailed(job.bucket, job.key, err)
+				p.fail(err)
+			}
+		}()
+	}
+	return p
+}
+
+// submit은 배치를 워커에게 넘깁니다. 모든 워커가 바쁘면 기다립니다.
+func (p *indexPool) submit(job indexJob) {
+	p.jobs <- job
+}
+
+// fail은 처리 중 발생한 오류를 모아 둡니다. nil은 무시합니다.
+func (p *indexPool) fail(err error) {
+	if err == nil {
+		return
+	}
+	p.mu.Lock()
+	p.errs = append(p.errs, err)
+	p.mu.Unlock()
+}
+
+// wait는 남은 배치를 모두 색인할 때까지 기다린 뒤 모아 둔 오류를 합쳐 반환합니다.
+func (p *indexPool) wait() error {
+	close(p.jobs)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return errors.Join(p.errs...)
+}
+
+// indexBatch는 배치 하나를 색인하고, 거부된 문서는 DLQ로 보냅니다.
+func (h *handler) indexBatch(ctx context.Context, job indexJob, opts indexOptions) (BatchResult, error) {
+	ctx = withArchiveTarget(ctx, h.archive, job.bucket, job.key, job.seq)
+	result, err := indexBatchToOpenSearch(ctx, job.batch, h.openSearch, opts)
+	if missing := result.skippedFor(skipMissingID); missing > 0 {
+		// ID가 없는 레코드가 많으면 원본 파일이 잘못되었을 수 있으므로 파일 위치와 함께 남깁니다.
+		logger.Warn("skipped records without ID", "bucket", job.bucket, "key", job.key,
+			"skipped", missing, "batch_size", len(job.batch))
+	}
+	err = h.deadLetterRejected(ctx, job.bucket, job.key, err)
+	if err != nil {
+		logger.Error("indexing failed", "bucket", job.bucket, "key", job.key, "batch_size", len(job.batch), "error", err)
+		return result, err
+	}
+	logger.Info("batch flushed", "bucket", job.bucket, "key", job.key, "batch_size", len(job.batch))
+	return result, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/linkedin/goavro/v2"
+)
+
+// productRecords는 productId가 p0..p(n-1)인 테스트 레코드 n개를 만듭니다.
+func productRecords(n int) []map[string]interface{} {
+	records := make([]map[string]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		records = append(records, map[string]interface{}{
+			"productId": goavro.Union("string", fmt.Sprintf("p%d", i)),
+			"title":     "상품",
+			"price":     nil,
+			"stock":     nil,
+		})
+	}
+	return records
+}
+
+func TestHandlerIndexesBatchesConcurrently(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "1")
+	setenv(t, "INDEX_CONCURRENCY", "3")
+
+	var inFlight, maxInFlight, requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	ocf := writeOCF(t, testProductSchema, productRecords(9)...)
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+		openSearch: testClient(t, server.URL),
+	}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if requests != 9 {
+		t.Errorf("Expected 9 bulk requests, but got %d", requests)
+	}
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("Expected between 2 and 3 concurrent requests, but got %d", maxInFlight)
+	}
+}
+
+// slowS3는 GetObject를 잠시 붙잡아 동시에 처리 중인 객체 수를 셉니다.
+type slowS3 struct {
+	*fakeS3
+	inFlight, maxInFlight int32
+}
+
+func (f *slowS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	n := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&f.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&f.maxInFlight, max, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return f.fakeS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func TestHandlerProcessesObjectsConcurrently(t *testing.T) {
+	setenv(t, "RECORD_CONCURRENCY", "2")
+
+	objects := map[string][]byte{}
+	var keys []string
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("feed-%d.avro", i)
+		keys = append(keys, key)
+		objects["feed-bucket/"+key] = writeOCF(t, testProductSchema, productRecords(2)...)
+	}
+	// 실패한 객체가 있어도 나머지 객체는 계속 처리합니다.
+	keys = append(keys, "missing.avro")
+	s3Client := &slowS3{fakeS3: &fakeS3{objects: objects}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", keys...))
+	if err == nil || !strings.Contains(err.Error(), "s3://feed-bucket/missing.avro") {
+		t.Fatalf("Expected the missing object error, but got %v", err)
+	}
+	if summary.RecordsRead != 8 {
+		t.Errorf("Expected 8 records read, but got %d", summary.RecordsRead)
+	}
+	if s3Client.maxInFlight != 2 {
+		t.Errorf("Expected 2 objects in flight, but got %d", s3Client.maxInFlight)
+	}
+}
+
+func TestHandlerRecordFailFast(t *testing.T) {
+	setenv(t, "RECORD_FAIL_FAST", "true")
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/b.avro": writeOCF(t, testProductSchema, productRecords(1)...)}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	_, err := h.handle(context.Background(), s3Event("feed-bucket", "missing.avro", "b.avro"))
+	if err == nil || !strings.Contains(err.Error(), "RECORD_FAIL_FAST") {
+		t.Fatalf("Expected the remaining objects to be cancelled, but got %v", err)
+	}
+	if len(s3Client.inputs) != 1 {
+		t.Errorf("Expected only the failed object to be fetched, but got %d calls", len(s3Client.inputs))
+	}
+}
+
+func TestIndexPoolAggregatesErrors(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "1")
+	setenv(t, "INDEX_CONCURRENCY", "2")
+	setenv(t, "OPENSEARCH_MAX_RETRIES", "0")
+
+	var mu sync.Mutex
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	ocf := writeOCF(t, testProductSchema, productRecords(3)...)
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+		openSearch: testClient(t, server.URL),
+	}
+	_, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro"))
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Expected joined errors, but got %v", err)
+	}
+	if len(joined.Unwrap()) != 3 || calls != 3 {
+		t.Errorf("Expected 3 failed batches out of 3 calls, but got %d errors and %d calls", len(joined.Unwrap()), calls)
+	}
+}
+
+func TestHandlerKeepsIndexingAfterFailures(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "2")
+	setenv(t, "OPENSEARCH_MAX_RETRIES", "0")
+
+	// 두 번째 배치만 실패시킵니다.
+	var mu sync.Mutex
+	var calls int
+	var indexed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+		for i := 0; i < len(lines); i += 2 {
+			var action map[string]map[string]interface{}
+			json.Unmarshal(lines[i], &action)
+			indexed = append(indexed, action["index"]["_id"].(string))
+		}
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	ocf := writeOCF(t, testProductSchema, productRecords(5)...)
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf, "feed-bucket/next.avro": ocf}},
+		openSearch: testClient(t, server.URL),
+	}
+	// 없는 파일이 앞에 있어도 뒤의 파일은 처리되어야 합니다.
+	_, err := h.handle(context.Background(), s3Event("feed-bucket", "missing.avro", "feed.avro", "next.avro"))
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 2 {
+		t.Fatalf("Expected the missing file and the failed batch as 2 joined errors, but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "missing.avro") || !strings.Contains(err.Error(), "400 Bad Request") {
+		t.Errorf("Expected both errors in the message, but got %v", err)
+	}
+	// feed.avro: [p0 p1] 성공, [p2 p3] 실패, [p4] 꼬리 배치 성공 / next.avro: 5건 모두 성공
+	expected := []string{"p0", "p1", "p4", "p0", "p1", "p2", "p3", "p4"}
+	if !reflect.DeepEqual(indexed, expected) {
+		t.Errorf("Expected tail batches to be indexed %v, but got %v", expected, indexed)
+	}
+}
+
+// BenchmarkHandler100kRecords는 레코드 10만 건 파일을 처리하는 동안의 최대 힙 크기를 보고합니다.
+// 파일 전체가 아니라 배치 몇 개분만 메모리에 남아야 합니다.
+//
+//	go test -run '^$' -bench Handler100k -benchmem
+func BenchmarkHandler100kRecords(b *testing.B) {
+	const records = 100000
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Schema: testProductSchema})
+	if err != nil {
+		b.Fatalf("Expected OCF writer, but got %v", err)
+	}
+	for i := 0; i < records; i += 1000 {
+		block := make([]interface{}, 0, 1000)
+		for j := i; j < i+1000; j++ {
+			block = append(block, map[string]interface{}{
+				"productId": goavro.Union("string", fmt.Sprintf("p%d", j)),
+				"title":     "무선 블루투스 이어폰 노이즈 캔슬링",
+				"price":     goavro.Union("string", "19900"),
+				"stock":     goavro.Union("long", int64(j)),
+			})
+		}
+		if err := w.Append(block); err != nil {
+			b.Fatalf("Expected records to be appended, but got %v", err)
+		}
+	}
+	ocf := buf.Bytes()
+
+	var peak uint64
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		mu.Lock()
+		if stats.HeapInuse > peak {
+			peak = stats.HeapInuse
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	previous := metricsOutput
+	metricsOutput = io.Discard
+	defer func() { metricsOutput = previous }()
+	previousLogger := logger
+	logger = newLogger("error")
+	defer func() { logger = previousLogger }()
+
+	client, err := newOpenSearchClient(server.URL, basicAuthorizer{}, newHTTPTransport(defaultRequestTimeout, nil, nil))
+	if err != nil {
+		b.Fatalf("Expected OpenSearch client, but got %v", err)
+	}
+	h := &handler{
+		config:     testConfig(b),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/large.avro": ocf}},
+		openSearch: client,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := h.handle(context.Background(), s3Event("feed-bucket", "large.avro")); err != nil {
+			b.Fatalf("Expected no error, but got %v", err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+	b.ReportMetric(float64(len(ocf))/(1<<20), "file-MB")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// 로컬 CLI 모드에서 요약과 로그에 표시되는 버킷 이름
+const localBucket = "local"
+
+// localFileGetter는 S3 대신 로컬 디스크에서 객체를 읽습니다. 키를 파일 경로로 사용합니다.
+type localFileGetter struct{}
+
+func (localFileGetter) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	f, err := os.Open(aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: f}, nil
+}
+
+// runLocal은 로컬 파일 하나를 Lambda와 같은 경로로 색인하고 요약을 out에 JSON으로 씁니다.
+// 프로세스 종료 코드를 반환합니다.
+func runLocal(ctx context.Context, path, openSearchURL string, out io.Writer) int {
+	if openSearchURL != "" {
+		os.Setenv("OPENSEARCH_URL", openSearchURL)
+	}
+	h, err := newHandlerFromEnv()
+	if err != nil {
+		logger.Error("failed to create handler", "error", err)
+		return 1
+	}
+	h.s3 = localFileGetter{}
+	// SIGTERM/Ctrl+C를 받으면 읽기를 멈추고 이미 읽은 레코드를 색인한 뒤 끝냅니다.
+	// 색인 요청은 ctx로 보내므로 종료 요청이 와도 마지막 배치가 취소되지 않습니다.
+	// 두 번째 신호는 기본 동작대로 프로세스를 바로 끝냅니다.
+	stopCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go func() {
+		<-stopCtx.Done()
+		stop()
+	}()
+	h.stop = stopCtx.Done()
+
+	summary, err := h.indexObjects(ctx, []objectRef{{bucket: localBucket, key: path}})
+	encoded, _ := json.MarshalIndent(summary, "", "  ")
+	fmt.Fprintln(out, string(encoded))
+	if err != nil {
+		logger.Error("indexing failed", "file", path, "error", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunLocal(t *testing.T) {
+	// runLocal이 바꾸는 환경 변수를 테스트 후 되돌립니다.
+	setenv(t, "OPENSEARCH_URL", "")
+	setenv(t, "METRICS_ENABLED", "false")
+
+	path := filepath.Join(t.TempDir(), "products.avro")
+	if err := os.WriteFile(path, writeOCF(t, testProductSchema, productRecords(3)...), 0o600); err != nil {
+		t.Fatalf("Expected Avro file to be written, but got %v", err)
+	}
+	recorder := newBulkRecorder(t)
+
+	var out bytes.Buffer
+	if code := runLocal(context.Background(), path, recorder.URL, &out); code != 0 {
+		t.Fatalf("Expected exit code 0, but got %d (%s)", code, out.String())
+	}
+	if _, docs := recorder.documents(t); len(docs) != 3 {
+		t.Errorf("Expected 3 documents, but got %d", len(docs))
+	}
+
+	var summary InvocationSummary
+	if err := json.Unmarshal(out.Bytes(), &summary); err != nil {
+		t.Fatalf("Expected a JSON summary, but got %s", out.Bytes())
+	}
+	if file := summary.Files[fileSummaryKey(localBucket, path)]; file == nil || file.DocumentsIndexed != 3 {
+		t.Errorf("Expected 3 indexed documents for %s, but got %s", path, out.Bytes())
+	}
+}
+
+func TestRunLocalMissingFile(t *testing.T) {
+	setenv(t, "OPENSEARCH_URL", "")
+	setenv(t, "METRICS_ENABLED", "false")
+	recorder := newBulkRecorder(t)
+
+	var out bytes.Buffer
+	if code := runLocal(context.Background(), filepath.Join(t.TempDir(), "missing.avro"), recorder.URL, &out); code != 1 {
+		t.Errorf("Expected exit code 1 for a missing file, but got %d", code)
+	}
+}
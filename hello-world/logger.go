@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logger는 CloudWatch Logs Insights에서 조회할 수 있도록 JSON 한 줄씩 기록합니다.
+var logger = newLogger(os.Getenv("LOG_LEVEL"))
+
+func newLogger(level string) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: parseLogLevel(level),
+	}))
+}
+
+// parseLogLevel은 debug, info, warn, error를 slog 레벨로 바꿉니다. 기본값은 info입니다.
+func parseLogLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
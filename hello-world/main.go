@@ -1,191 +1,765 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/linkedin/goavro/v2"
-	"net/http"
+	"github.com/opensearch-project/opensearch-go/v2"
+	"net/url"
 	"os"
-	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-func HandleRequest(ctx context.Context, s3Event events.S3Event) {
-	openSearchURL := os.Getenv("OPENSEARCH_URL")
+// 환경 변수로 리전을 찾지 못했을 때 사용하는 기본 리전
+const defaultRegion = "ap-northeast-2"
 
-	sess, _ := session.NewSession(&aws.Config{
-		Region: aws.String("ap-northeast-2")}, // AWS 리전 설정
-	)
+const (
+	defaultBatchSize    = 1000
+	defaultMaxBulkBytes = 5 << 20 // 5 MiB
+	// 1이면 기존처럼 배치를 하나씩 차례로 색인
+	defaultIndexConcurrency = 1
+	// 1이면 기존처럼 이벤트의 객체를 하나씩 차례로 처리
+	defaultRecordConcurrency = 1
+)
 
-	s3Client := s3.New(sess)
+// resolveRegion은 AWS_REGION, AWS_DEFAULT_REGION 순서로 리전을 읽습니다.
+// 둘 다 없으면 빈 문자열을 반환합니다.
+func resolveRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
 
-	for _, record := range s3Event.Records {
+// S3Getter는 handler가 사용하는 S3 API입니다. 테스트에서는 가짜 구현으로 대체합니다.
+type S3Getter interface {
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+}
 
-		bucket := record.S3.Bucket.Name
-		key := record.S3.Object.Key
-		// S3에서 Avro 파일 가져오기
-		result, err := s3Client.GetObject(&s3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
-		})
-		if err != nil {
-			fmt.Printf("Error getting Avro file from S3: %s\n", err)
-			return
-		}
-		bodyReader := bufio.NewReader(result.Body)
+// handler는 S3 이벤트 하나를 읽기→변환→색인 순서로 처리합니다.
+type handler struct {
+	s3 S3Getter
+	// 이벤트 레코드의 리전별 S3 클라이언트 (nil이면 항상 s3 사용)
+	s3Regions  *s3ClientCache
+	openSearch *opensearch.Client
+	// 색인하지 못한 레코드를 보관할 곳 (nil이면 사용하지 않음)
+	dlq deadLetterSink
+	// Avro 파일을 읽을 때 기대하는 reader 스키마를 가져올 레지스트리 (nil이면 검사하지 않음)
+	schemas *schemaRegistry
+	// 문서에 categoryLabel을 넣을 보강 테이블 (nil이면 사용하지 않음)
+	enrichment *enrichmentTable
+	// 보낸 _bulk 본문을 남길 S3 위치 (nil이면 사용하지 않음)
+	archive *bulkArchiver
+	// 컨테이너를 시작할 때 한 번 읽은 처리 설정
+	config handlerConfig
+	// 닫히면 새 레코드를 읽지 않고 이미 읽은 배치만 색인한 뒤 끝냅니다. (로컬 모드의 SIGTERM)
+	// Lambda에서는 nil이므로 영향이 없습니다.
+	stop <-chan struct{}
+}
 
-		// Avro 파일 읽기 및 처리
-		ocfr, err := goavro.NewOCFReader(bodyReader)
-		if err != nil {
-			fmt.Printf("Error creating OCF reader: %s\n", err)
-			return
-		}
-		// HandleRequest 함수 내에서
-		var batchData []interface{}
-		// Avro 레코드 처리
-		for ocfr.Scan() {
-			avroRecord, err := ocfr.Read()
-			if err != nil {
-				fmt.Println("Error reading datum:", err)
-				continue
-			}
+// stopping은 종료 요청을 받았는지 확인합니다.
+func (h *handler) stopping() bool {
+	select {
+	case <-h.stop:
+		return true
+	default:
+		return false
+	}
+}
 
-			// 타입 단언을 사용하여 rawDatum을 map[string]interface{} 타입으로 변환
-			rawDatum, ok := avroRecord.(map[string]interface{})
-			if !ok {
-				fmt.Println("Error asserting datum to map[string]interface{}")
-				continue
-			}
+var (
+	sharedHandlerMu sync.Mutex
+	sharedHandler   *handler
+)
 
-			// 필요한 데이터 변환 수행
-			for key, value := range rawDatum {
+// getHandler는 세션, S3 클라이언트, OpenSearch 클라이언트를 컨테이너당 한 번만 만듭니다.
+// 웜 호출은 같은 연결을 재사용합니다. 생성에 실패하면 다음 호출에서 다시 시도합니다.
+func getHandler() (*handler, error) {
+	sharedHandlerMu.Lock()
+	defer sharedHandlerMu.Unlock()
 
-				if valueMap, ok := value.(map[string]interface{}); ok {
+	if sharedHandler != nil {
+		return sharedHandler, nil
+	}
+	h, err := newHandlerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	sharedHandler = h
+	return h, nil
+}
 
-					if stringValue, ok := valueMap["string"].(string); ok {
-						rawDatum[key] = stringValue
-					}
-					if longValue, ok := valueMap["long"].(int64); ok {
-						rawDatum[key] = longValue
-					}
-					if intValue, ok := valueMap["int"].(int32); ok {
-						rawDatum[key] = intValue
-					}
-				}
-			}
+// newHandlerFromEnv는 환경 변수 설정으로 실제 AWS/OpenSearch 구현을 연결합니다.
+func newHandlerFromEnv() (*handler, error) {
+	// AWS 리전 설정: 환경 변수가 있으면 우선 사용하고, 없으면 SDK 기본 해석에 맡깁니다.
+	awsConfig := aws.NewConfig()
+	if region := resolveRegion(); region != "" {
+		awsConfig = awsConfig.WithRegion(region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *awsConfig,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %w", err)
+	}
+	// SDK도 리전을 찾지 못하면 기존 기본값(서울 리전)을 사용
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(defaultRegion)
+	}
 
-			// "webcastAddSales" 필드를 숫자로 변환
-			webcastAddSalesStr, ok := rawDatum["webcastAddSales"].(string)
-			if ok {
-				webcastAddSales, err := strconv.ParseFloat(webcastAddSalesStr, 64)
-				if err == nil {
-					rawDatum["webcastAddSales"] = webcastAddSales
-				}
-			}
+	auth, err := newAuthorizer(sess)
+	if err != nil {
+		return nil, err
+	}
+	if refresh := os.Getenv("REFRESH"); refresh != "" && serverlessFromEnv() {
+		logger.Warn("REFRESH is not supported by OpenSearch Serverless, ignoring it", "refresh", refresh)
+	}
 
-			// "webcastSalesMoney" 필드를 숫자로 변환
-			webcastSalesMoneyStr, ok := rawDatum["webcastSalesMoney"].(string)
-			if ok {
-				webcastSalesMoney, err := strconv.ParseFloat(webcastSalesMoneyStr, 64)
-				if err == nil {
-					rawDatum["webcastSalesMoney"] = webcastSalesMoney
-				}
-			}
+	dlq, err := newDeadLetterSink(sess, os.Getenv("DLQ_TARGET"))
+	if err != nil {
+		return nil, err
+	}
+	archive, err := newBulkArchiverFromEnv(sess)
+	if err != nil {
+		return nil, err
+	}
+	config, err := configFromEnv()
+	if err != nil {
+		return nil, err
+	}
 
-			// "price" 필드를 숫자로 변환
-			priceStr, ok := rawDatum["price"].(string)
-			if ok {
-				price, err := strconv.ParseFloat(priceStr, 64)
-				if err == nil {
-					rawDatum["price"] = price
-				}
-			}
+	tlsConfig, err := newTLSConfig(os.Getenv("OPENSEARCH_CA_CERT"), envBool("OPENSEARCH_INSECURE_SKIP_VERIFY", false))
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := parseProxyURL(os.Getenv("OPENSEARCH_PROXY"))
+	if err != nil {
+		return nil, err
+	}
+	// 요청 하나의 제한 시간 (0이면 호출 컨텍스트의 마감만 적용)
+	timeout := envDurationSeconds("OPENSEARCH_TIMEOUT_SECONDS", defaultRequestTimeout)
+	client, err := newOpenSearchClient(os.Getenv("OPENSEARCH_URL"), auth, newHTTPTransport(timeout, tlsConfig, proxy))
+	if err != nil {
+		return nil, err
+	}
 
-			batchData = append(batchData, rawDatum)
+	// 새 환경에서 동적 매핑이 숫자 문자열 필드의 타입을 잘못 추측하지 않도록 인덱스를 미리 만듭니다.
+	// 핸들러는 컨테이너당 한 번만 만들어지므로 배치마다 요청하지 않습니다.
+	if envBool("CREATE_INDEX", false) {
+		if err := bootstrapIndex(context.Background(), client, newIndexNamer()); err != nil {
+			return nil, err
+		}
+	}
 
-			// 배치 크기에 도달하거나 마지막 레코드인 경우 색인화
-			if len(batchData) >= 1000 {
-				err = indexBatchToOpenSearch(batchData, openSearchURL)
-				if err != nil {
-					fmt.Printf("Error indexing batch to OpenSearch: %s\n", err)
-				}
-				batchData = nil // 배치 초기화
-			}
+	// 추가 요청을 감당할 수 없는 환경도 있으므로 켰을 때만 확인합니다.
+	// 요청마다 OPENSEARCH_TIMEOUT_SECONDS가 적용됩니다.
+	if envBool("STARTUP_HEALTHCHECK", false) {
+		if err := checkOpenSearch(context.Background(), client, newIndexNamer()); err != nil {
+			return nil, err
 		}
-		if len(batchData) > 0 {
-			err = indexBatchToOpenSearch(batchData, openSearchURL)
-			if err != nil {
-				fmt.Printf("Error indexing batch to OpenSearch: %s\n", err)
-			}
+	}
+
+	// 롤오버 별칭에 색인할 때 읽기 전용 별칭을 가리키고 있지 않은지 확인합니다.
+	if envBool("INDEX_IS_ALIAS", false) {
+		if indexNames := newIndexNamer(); indexNames.dateSuffix || indexNames.indexField != "" {
+			logger.Warn("INDEX_IS_ALIAS is ignored when the index name changes per document", "index", indexNames.base)
+		} else if _, err := checkWriteAlias(context.Background(), client, indexNames.base); err != nil {
+			return nil, err
 		}
+	}
 
+	schemas, err := newSchemaRegistryFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultS3 := traceS3(s3.New(sess))
+	h := &handler{
+		s3:         defaultS3,
+		s3Regions:  newS3ClientCache(sess, aws.StringValue(sess.Config.Region), defaultS3),
+		openSearch: client,
+		dlq:        dlq,
+		schemas:    schemas,
+		archive:    archive,
+		config:     config,
 	}
+	// 보강 테이블은 컨테이너당 한 번만 읽습니다. 읽지 못하면 라벨 없는 문서를 색인하지 않도록 시작을 막습니다.
+	h.enrichment, err = h.loadEnrichment(context.Background(), os.Getenv("ENRICHMENT_S3_URI"))
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
-func indexBatchToOpenSearch(batchData []interface{}, openSearchURL string) error {
+// HandleRequest는 S3 이벤트 또는 직접 호출로 받은 레코드 배열을 처리하고 결과 요약을 반환합니다.
+// 오류가 있으면 Lambda가 요약 대신 오류를 반환하므로 호출이 재시도/DLQ 대상이 됩니다.
+func HandleRequest(ctx context.Context, payload json.RawMessage) (InvocationSummary, error) {
+	h, err := getHandler()
+	if err != nil {
+		return InvocationSummary{Version: summaryVersion}, err
+	}
+	// 차단기가 열려 있으면 객체를 읽지 않고 바로 실패해 이벤트가 나중에 재시도되게 합니다.
+	// probe는 첫 _bulk 요청이 보내야 하므로 여기서는 차례를 차지하지 않습니다.
+	if err := h.config.index.sender.breaker.check(); err != nil {
+		return InvocationSummary{Version: summaryVersion}, err
+	}
+	return h.handleInvocation(ctx, payload)
+}
 
-	// 환경 변수에서 OpenSearch의 사용자 이름과 비밀번호를 읽습니다.
-	username := os.Getenv("OPENSEARCH_USERNAME")
-	password := os.Getenv("OPENSEARCH_PASSWORD")
+// handleInvocation은 페이로드가 S3 이벤트인지 레코드 배열인지 보고 알맞은 처리로 넘깁니다.
+func (h *handler) handleInvocation(ctx context.Context, payload []byte) (InvocationSummary, error) {
+	s3Event, records, err := parseInvocation(payload)
+	if err != nil {
+		return InvocationSummary{Version: summaryVersion}, err
+	}
+	if s3Event != nil {
+		return h.handle(ctx, *s3Event)
+	}
+	return h.handleRecords(ctx, records)
+}
+
+// parseInvocation은 Records의 항목마다 s3 키가 있으면 S3 이벤트로, 최상위가 배열이면 레코드 배열로 읽습니다.
+func parseInvocation(payload []byte) (*events.S3Event, []json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var records []json.RawMessage
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, nil, fmt.Errorf("invalid records payload: %w", err)
+		}
+		return nil, records, nil
+	}
 
-	//signer *v4.Signer
-	var buffer bytes.Buffer
-	for _, data := range batchData {
-		dataMap := data.(map[string]interface{})
-		productId, ok := dataMap["productId"].(string)
-		if !ok {
-			// productId가 없는 경우 오류 처리
+	var probe struct {
+		Records []map[string]json.RawMessage `json:"Records"`
+	}
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return nil, nil, fmt.Errorf("invalid event payload: %w", err)
+	}
+	if probe.Records == nil {
+		return nil, nil, errors.New("unsupported event: expected an S3 event or a JSON array of records")
+	}
+	for i, record := range probe.Records {
+		if _, ok := record["s3"]; !ok {
+			return nil, nil, fmt.Errorf("unsupported event: record %d has no s3 field", i)
+		}
+	}
+	var s3Event events.S3Event
+	if err := json.Unmarshal(trimmed, &s3Event); err != nil {
+		return nil, nil, fmt.Errorf("invalid S3 event: %w", err)
+	}
+	return &s3Event, nil, nil
+}
+
+// processOptions는 파일 하나를 배치로 나누고 변환하는 방식을 정합니다.
+type processOptions struct {
+	batchSize    int
+	maxBulkBytes int
+	normalize    normalizeOptions
+	// 색인하기 전에 레코드를 검사하는 규칙 (없으면 nil)
+	validation *validationRules
+	// 파일 하나에서 읽지 못한 레코드가 이보다 많으면 파일을 포기 (0이면 제한 없음)
+	maxRecordErrors int
+	// false면 레코드가 하나도 없는 파일을 오류로 처리
+	allowEmptyFiles bool
+	// 객체 본문을 읽는 버퍼 크기
+	readBufferBytes int
+	// 0보다 크면 배치가 차지 않아도 이 간격마다 모은 레코드를 보냅니다. (스트리밍 입력용)
+	flushInterval time.Duration
+}
+
+func (h *handler) handle(ctx context.Context, s3Event events.S3Event) (InvocationSummary, error) {
+	var objects []objectRef
+	for _, record := range s3Event.Records {
+		key := objectKey(record)
+		// 삭제 알림은 GetObject가 404가 되므로 가져오지 않고 건너뜁니다.
+		if strings.HasPrefix(record.EventName, "ObjectRemoved:") {
+			logger.Info("skipped removed object", "bucket", record.S3.Bucket.Name, "key", key, "event", record.EventName)
 			continue
 		}
-		metaData := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index": "products",
-				"_id":    productId,
-			},
+		objects = append(objects, objectRef{bucket: record.S3.Bucket.Name, key: key, region: record.AWSRegion, versionID: record.S3.Object.VersionID})
+	}
+	return h.indexObjects(ctx, objects)
+}
+
+// objectRef는 처리할 객체 하나의 위치입니다.
+type objectRef struct {
+	bucket string
+	key    string
+	// 버킷의 리전 (비어 있으면 함수 리전의 클라이언트 사용)
+	region string
+	// 알림을 보낸 객체 버전 (버전 관리를 쓰지 않는 버킷이면 비어 있음)
+	versionID string
+}
+
+// indexObjects는 객체들을 읽기→변환→배치→색인 순서로 처리하고 결과 요약을 반환합니다.
+// Lambda 핸들러와 로컬 CLI 모드가 함께 사용합니다.
+func (h *handler) indexObjects(ctx context.Context, objects []objectRef) (InvocationSummary, error) {
+	start := time.Now()
+	config := h.config
+
+	// RECORD_FAIL_FAST면 파일 하나가 실패할 때 나머지 파일도 취소합니다.
+	objectCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// 파일 오류와 배치별 색인 오류를 모두 pool에 모아 마지막에 합쳐서 반환합니다.
+	// 배치 하나가 실패해도 다른 배치와 파일은 계속 처리합니다.
+	pool := h.startIndexPool(objectCtx, config.indexConcurrency, config.index)
+
+	// 객체는 서로 독립적이므로 최대 RECORD_CONCURRENCY개를 동시에 가져오고 색인합니다.
+	// S3/OpenSearch 클라이언트는 동시에 사용해도 안전합니다.
+	slots := make(chan struct{}, config.recordConcurrency)
+	var objectsWG sync.WaitGroup
+	for _, object := range objects {
+		slots <- struct{}{}
+		if objectCtx.Err() != nil {
+			// 제한 시간이 지나면(또는 RECORD_FAIL_FAST로 취소되면) 남은 파일은 시작하지 않습니다.
+			<-slots
+			pool.fail(fmt.Errorf("invocation cancelled before processing remaining objects: %w", context.Cause(objectCtx)))
+			break
+		}
+		if h.stopping() {
+			<-slots
+			pool.fail(errors.New("stopped before processing remaining objects"))
+			break
 		}
-		jsonMeta, _ := json.Marshal(metaData)
-		buffer.Write(jsonMeta)
-		buffer.WriteString("\n")
+		objectsWG.Add(1)
+		go func(object objectRef) {
+			defer func() {
+				<-slots
+				objectsWG.Done()
+			}()
+			err := h.processObject(objectCtx, pool, object, config.process)
+			pool.metrics.fileFailed(object.bucket, object.key, err)
+			pool.fail(err)
+			if err != nil && config.failFast {
+				cancel(fmt.Errorf("s3://%s/%s failed and RECORD_FAIL_FAST is set", object.bucket, object.key))
+			}
+		}(object)
+	}
+	objectsWG.Wait()
+	return h.finishInvocation(pool, config, start)
+}
+
+// handleRecords는 직접 호출로 받은 레코드를 S3 객체와 같은 방식으로 변환하고 색인합니다.
+// 요약에는 directInvocationKey라는 파일 하나로 나타납니다.
+func (h *handler) handleRecords(ctx context.Context, records []json.RawMessage) (InvocationSummary, error) {
+	start := time.Now()
+	config := h.config
+	pool := h.startIndexPool(ctx, config.indexConcurrency, config.index)
+
+	source := recordSource{key: directInvocationKey, format: formatJSONPayload, location: "direct invocation payload"}
+	decodeStart := time.Now()
+	processed := h.processRecords(ctx, pool, source, &payloadDecoder{items: records}, nil, config.process, nil)
+	pool.metrics.fileDecoded(source.bucket, source.key, 0, time.Since(decodeStart)-processed.submitWait, 0, processed.records)
+	pool.metrics.fileFailed(source.bucket, source.key, processed.err)
+	pool.fail(processed.err)
+	return h.finishInvocation(pool, config, start)
+}
+
+// directInvocationKey는 직접 호출로 받은 레코드를 요약과 DLQ에서 가리키는 이름입니다.
+const directInvocationKey = "direct-invocation"
 
-		// 실제 데이터 작성 (doc 필드 없이 직접 삽입)
-		jsonData, _ := json.Marshal(data)
-		buffer.Write(jsonData)
-		buffer.WriteString("\n")
+// handlerConfig는 컨테이너를 시작할 때 환경 변수에서 한 번 읽는 처리 설정입니다.
+// newHandlerFromEnv가 configFromEnv로 만들어 handler에 넣고, 호출은 환경 변수를 다시 읽지 않고 이 값을 넘겨 씁니다.
+type handlerConfig struct {
+	process processOptions
+	index   indexOptions
+	s3      s3Options
+	// 배치를 동시에 색인하는 워커 수 (INDEX_CONCURRENCY)와 동시에 처리하는 객체 수 (RECORD_CONCURRENCY)
+	indexConcurrency  int
+	recordConcurrency int
+	// 파일 하나가 실패하면 나머지 파일도 취소할지 여부 (RECORD_FAIL_FAST)
+	failFast bool
+	// 지표를 남길 CloudWatch 네임스페이스 (METRICS_ENABLED=false면 비어 있음)
+	metricsNamespace string
+}
+
+// configFromEnv는 환경 변수에서 처리 설정을 모두 읽습니다.
+func configFromEnv() (handlerConfig, error) {
+	index, err := indexOptionsFromEnv()
+	if err != nil {
+		return handlerConfig{}, err
 	}
+	config := handlerConfig{
+		process:           processOptionsFromEnv(),
+		index:             index,
+		s3:                s3OptionsFromEnv(),
+		indexConcurrency:  envInt("INDEX_CONCURRENCY", defaultIndexConcurrency),
+		recordConcurrency: envInt("RECORD_CONCURRENCY", defaultRecordConcurrency),
+		failFast:          envBool("RECORD_FAIL_FAST", false),
+	}
+	if config.recordConcurrency < 1 {
+		config.recordConcurrency = 1
+	}
+	if envBool("METRICS_ENABLED", true) {
+		config.metricsNamespace = os.Getenv("METRICS_NAMESPACE")
+		if config.metricsNamespace == "" {
+			config.metricsNamespace = defaultMetricsNamespace
+		}
+	}
+	return config, nil
+}
 
-	req, _ := http.NewRequest("POST", openSearchURL+"/_bulk", &buffer)
+// processOptionsFromEnv는 환경 변수에서 파일 처리 옵션을 읽습니다.
+func processOptionsFromEnv() processOptions {
+	return processOptions{
+		batchSize:       envInt("BATCH_SIZE", defaultBatchSize),
+		maxBulkBytes:    envInt("MAX_BULK_BYTES", defaultMaxBulkBytes),
+		normalize:       normalizeOptionsFromEnv(),
+		validation:      validationRulesFromEnv(),
+		maxRecordErrors: envInt("MAX_RECORD_ERRORS", 0),
+		allowEmptyFiles: envBool("ALLOW_EMPTY_FILES", true),
+		readBufferBytes: envInt("READ_BUFFER_BYTES", defaultReadBufferBytes),
+		flushInterval:   flushIntervalFromEnv(),
+	}
+}
 
-	// ID와 패스워드를 결합하고 Base64로 인코딩합니다.
-	auth := username + ":" + password
-	authEncoded := base64.StdEncoding.EncodeToString([]byte(auth))
+// finishInvocation은 넘긴 배치가 모두 색인되기를 기다린 뒤 지표를 남기고 요약을 반환합니다.
+func (h *handler) finishInvocation(pool *indexPool, config handlerConfig, start time.Time) (InvocationSummary, error) {
+	// 이미 넘긴 배치는 파일 오류가 있어도 끝까지 색인합니다.
+	err := pool.wait()
+	pool.metrics.logFileTimings()
+	if config.metricsNamespace != "" {
+		if emitErr := pool.metrics.emit(metricsOutput, config.metricsNamespace, config.index.indexNames.base, time.Since(start)); emitErr != nil {
+			logger.Warn("failed to emit metrics", "error", emitErr)
+		}
+	}
+	return pool.metrics.summary(), err
+}
 
-	// Authorization 헤더를 설정합니다.
-	req.Header.Set("Authorization", "Basic "+authEncoded)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Content-Type", "application/json")
+// objectKey는 이벤트에 URL 인코딩되어 들어오는 객체 키를 원래 키로 되돌립니다.
+// 공백은 "+", 한글 등은 "%XX"로 인코딩되어 있습니다.
+func objectKey(record events.S3EventRecord) string {
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		logger.Warn("failed to decode object key, using it as-is", "key", record.S3.Object.Key, "error", err)
+		return record.S3.Object.Key
+	}
+	return key
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// processObject는 S3 객체 하나를 읽어 변환한 뒤 배치 단위로 pool에 넘깁니다.
+// 객체를 가져오거나 열지 못하면 오류를 반환합니다.
+func (h *handler) processObject(ctx context.Context, pool *indexPool, object objectRef, opts processOptions) error {
+	bucket, key := object.bucket, object.key
+	// S3에서 객체 가져오기 (일시적인 오류는 재시도)
+	getStart := time.Now()
+	result, err := h.getObject(ctx, object)
+	getDuration := time.Since(getStart)
+	if err != nil && ctx.Err() != nil {
+		// Lambda 제한 시간이 다가와 취소된 경우
+		logger.Error("get object cancelled", "bucket", bucket, "key", key, "error", ctx.Err())
+		return fmt.Errorf("getting object s3://%s/%s cancelled: %w", bucket, key, ctx.Err())
+	}
+	if err != nil {
+		logger.Error("failed to get object", "bucket", bucket, "key", key, "error", err)
+		return fmt.Errorf("error getting object s3://%s/%s: %w", bucket, key, err)
+	}
+	// 가짜 클라이언트 등은 오류 없이 본문을 비워 둘 수 있으므로 nil을 역참조하지 않습니다.
+	if result == nil || result.Body == nil {
+		logger.Error("get object returned no body", "bucket", bucket, "key", key)
+		return fmt.Errorf("error getting object s3://%s/%s: response has no body", bucket, key)
+	}
+	logger.Info("file opened", "bucket", bucket, "key", key)
+	// gzip으로 압축된 객체는 압축을 풀어서 읽습니다.
+	// 본문은 디코딩하면서 읽으므로 읽는 데 걸린 시간을 따로 재서 다운로드 시간에 더합니다.
+	// 큰 파일은 진행 상황을 남기고, 설정하면 연결이 끊겨도 끊긴 위치부터 이어 받습니다.
+	body := &timedReader{ReadCloser: h.newResumableBody(ctx, object, result)}
+	bodyReader, err := openObjectBody(body, key, aws.StringValue(result.ContentEncoding), opts.readBufferBytes)
+	if errors.Is(err, errEmptyObject) {
+		// 0바이트 객체(폴더 표시용 키 등)는 OCF 헤더도 없으므로 디코딩하지 않고 건너뜁니다.
+		logger.Warn("skipped empty object", "bucket", bucket, "key", key)
+		pool.metrics.fileRead(bucket, key, 0, 0)
+		if !opts.allowEmptyFiles {
+			return fmt.Errorf("s3://%s/%s is empty", bucket, key)
+		}
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error sending bulk request to OpenSearch: %v", err)
+		return fmt.Errorf("error reading s3://%s/%s: %w", bucket, key, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error response from OpenSearch: %v", resp.Status)
+	// 키 확장자나 Content-Type에 맞는 형식으로 레코드 읽기
+	format := objectFormat(key, aws.StringValue(result.ContentType))
+	decoder, err := newRecordDecoder(format, bodyReader)
+	if err != nil {
+		bodyReader.Close()
+		return fmt.Errorf("error decoding s3://%s/%s: %w", bucket, key, err)
+	}
+	// 레지스트리의 스키마와 맞지 않는 파일은 레코드를 읽기 전에 실패시킵니다.
+	var reader *readerSchema
+	if avro, ok := decoder.(*avroOCFDecoder); ok && h.schemas != nil {
+		if reader, err = h.schemas.readerSchema(ctx); err != nil {
+			bodyReader.Close()
+			return fmt.Errorf("error checking schema of s3://%s/%s: %w", bucket, key, err)
+		}
+		if err := reader.checkCompatible(avro.writerSchema()); err != nil {
+			bodyReader.Close()
+			logger.Error("file schema is incompatible with the registered schema", "bucket", bucket, "key", key,
+				"subject", h.schemas.subject, "version", reader.version, "error", err)
+			return fmt.Errorf("s3://%s/%s is incompatible with schema %s version %d: %w", bucket, key, h.schemas.subject, reader.version, err)
+		}
 	}
 
-	return nil
+	decodeStart := time.Now()
+	source := recordSource{bucket: bucket, key: key, format: format, location: fmt.Sprintf("s3://%s/%s", bucket, key)}
+	processed := h.processRecords(ctx, pool, source, decoder, reader, opts, bodyReader.Close)
+	pool.metrics.fileDecoded(bucket, key, getDuration+body.elapsed, time.Since(decodeStart)-body.elapsed-processed.submitWait, body.bytes, processed.records)
+	return processed.err
+}
+
+// recordSource는 레코드를 읽는 위치입니다. 지표와 요약은 bucket/key로 구분하고 오류 메시지에는 location을 씁니다.
+type recordSource struct {
+	bucket   string
+	key      string
+	format   string
+	location string
+}
+
+// recordsResult는 processRecords가 레코드를 처리한 결과입니다.
+type recordsResult struct {
+	// 읽은 레코드 수
+	records int
+	// 워커가 모두 바빠 배치를 넘기지 못하고 기다린 시간 (디코딩 시간에서 뺌)
+	submitWait time.Duration
+	// 파일을 끝까지 처리하지 못했거나 처리 결과가 잘못된 경우의 오류
+	err error
+}
+
+// processRecords는 decoder의 레코드를 변환·검증해 배치 단위로 pool에 넘기고 bucket/key 기준으로 지표를 남깁니다.
+// S3 객체와 직접 호출로 받은 레코드가 함께 사용합니다. closeInput은 마지막 배치를 넘기기 전에 입력을 닫습니다. (없으면 nil)
+func (h *handler) processRecords(ctx context.Context, pool *indexPool, source recordSource, decoder RecordDecoder,
+	reader *readerSchema, opts processOptions, closeInput func() error) recordsResult {
+	bucket, key, format := source.bucket, source.key, source.format
+	normalize := opts.normalize
+	normalize.enrichment = h.enrichment
+	if normalize.ingestMetadata {
+		normalize.sourceKey = key
+		normalize.ingestedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if avro, ok := decoder.(*avroOCFDecoder); ok {
+		normalize.unionNames = avro.unionNames()
+		if normalize.tagSchema {
+			normalize.schemaFingerprint = avro.schemaFingerprint()
+		}
+	}
+
+	var batchData []interface{}
+	var recordCount int
+	// 건너뛴 잘못된 레코드 수
+	var recordErrors int
+	// 그중 객체가 아닌 값이라 건너뛴 레코드 수 (나머지는 디코딩 오류)
+	var typeAssertErrors int
+	// 검증 규칙을 통과하지 못해 색인하지 않은 레코드
+	var invalid []deadLetter
+	// 읽지 못한 레코드가 MAX_RECORD_ERRORS를 넘어 파일을 포기한 이유
+	var abandonErr error
+	// 종료 요청으로 파일을 끝까지 읽지 못한 경우
+	var stopped bool
+	// 현재 배치의 예상 _bulk 본문 크기 (레코드를 추가할 때마다 누적)
+	var batchBytes int
+	// 지금까지 넘긴 배치 수
+	var batches int
+	// 워커가 모두 바빠 배치를 넘기지 못하고 기다린 시간 (디코딩 시간에서 뺌)
+	var submitWait time.Duration
+	flush := func() {
+		submitStart := time.Now()
+		pool.submit(indexJob{bucket: bucket, key: key, batch: batchData, seq: batches})
+		batches++
+		submitWait += time.Since(submitStart)
+		// 넘긴 슬라이스는 워커만 참조하고 색인이 끝나면 해제됩니다.
+		// 같은 배열을 재사용하지 않으므로 메모리에는 워커 수 + 1개 배치만 남습니다.
+		batchData = nil
+		batchBytes = 0
+	}
+	// FLUSH_INTERVAL을 쓰면 읽기를 기다리는 동안에도 배치를 보낼 수 있도록 다른 고루틴에서 읽습니다.
+	var records <-chan scannedRecord
+	var tick <-chan time.Time
+	done := make(chan struct{})
+	if opts.flushInterval > 0 {
+		records = scanRecords(decoder, done)
+		ticker := time.NewTicker(opts.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	// 레코드 처리
+read:
+	for {
+		// 종료 요청을 받으면 더 읽지 않고, 지금까지 모은 배치는 아래에서 색인합니다.
+		if h.stopping() {
+			stopped = true
+			break
+		}
+		var scanned scannedRecord
+		if records == nil {
+			var ok bool
+			if scanned, ok = scanNext(decoder); !ok {
+				break
+			}
+		} else {
+			select {
+			case next, ok := <-records:
+				if !ok {
+					break read
+				}
+				scanned = next
+			case <-tick:
+				if len(batchData) > 0 {
+					logger.Debug("flushing partial batch after FLUSH_INTERVAL", "bucket", bucket, "key", key, "batch_size", len(batchData))
+					flush()
+				}
+				continue
+			case <-h.stop:
+				stopped = true
+				break read
+			case <-ctx.Done():
+				abandonErr = fmt.Errorf("reading cancelled after %d records: %w", recordCount, ctx.Err())
+				break read
+			}
+		}
+		rawDatum, err := scanned.datum, scanned.err
+		if err != nil {
+			// 리더가 더 읽을 수 없게 된 오류(손상된 블록 등)는 아래 decoder.Err()에서 처리합니다.
+			if scanned.fatal {
+				break
+			}
+			// 레코드 하나만 잘못된 경우 건너뛰고 개수를 셉니다.
+			recordErrors++
+			if isTypeAssertError(err) {
+				typeAssertErrors++
+			}
+			logger.Warn("failed to read datum", "bucket", bucket, "key", key, "error", err)
+			// 형식이 통째로 잘못된 파일은 끝까지 읽어도 로그만 쌓이므로 포기합니다.
+			if opts.maxRecordErrors > 0 && recordErrors > opts.maxRecordErrors {
+				abandonErr = fmt.Errorf("%d of %d records failed to decode (MAX_RECORD_ERRORS=%d)",
+					recordErrors, recordCount+recordErrors, opts.maxRecordErrors)
+				break
+			}
+			continue
+		}
+		recordCount++
+
+		// reader 스키마에 맞춰 필드를 정리한 뒤 필요한 데이터 변환 수행
+		if reader != nil {
+			reader.project(rawDatum)
+		}
+		rawDatum = normalizeRecord(rawDatum, normalize)
+		if err := opts.validation.validate(rawDatum); err != nil {
+			id, _ := documentID(rawDatum[pool.index.idField])
+			logger.Warn("skipped invalid record", "bucket", bucket, "key", key, "id", id, "error", err)
+			invalid = append(invalid, deadLetter{
+				ProductID:    id,
+				SourceBucket: bucket,
+				SourceKey:    key,
+				Error:        "validation_failed: " + err.Error(),
+				FailedAt:     time.Now().UTC().Format(time.RFC3339),
+				Record:       rawDatum,
+			})
+			continue
+		}
+
+		batchData = append(batchData, rawDatum)
+		batchBytes += estimateBulkBytes(rawDatum)
+
+		// 레코드 수나 본문 크기 중 먼저 도달한 기준에 맞춰 색인화
+		if len(batchData) >= opts.batchSize || batchBytes >= opts.maxBulkBytes {
+			flush()
+		}
+	}
+	close(done)
+	if closeInput != nil {
+		if err := closeInput(); err != nil {
+			logger.Error("failed to close object body", "bucket", bucket, "key", key, "error", err)
+			pool.fail(fmt.Errorf("error closing %s: %w", source.location, err))
+		}
+	}
+	// 읽던 고루틴은 입력이 닫히면 끝나므로 decoder 상태를 보기 전에 기다립니다.
+	if records != nil {
+		for range records {
+		}
+	}
+	// 파일 중간에 리더가 멈추면 그때까지 읽은 레코드만 색인합니다.
+	readErr := decoder.Err()
+
+	// 마지막 남은 레코드 색인화
+	if len(batchData) > 0 {
+		flush()
+	}
+	pool.metrics.fileRead(bucket, key, recordCount, recordErrors)
+	// 리더가 중간에 실패한 파일도 디코딩 오류 하나로 셉니다.
+	decodeErrors := recordErrors - typeAssertErrors
+	if readErr != nil {
+		decodeErrors++
+	}
+	pool.metrics.recordsUndecoded(decodeErrors, typeAssertErrors)
+	if len(invalid) > 0 {
+		pool.metrics.fileInvalid(bucket, key, len(invalid))
+		if err := h.deadLetterInvalid(ctx, invalid); err != nil {
+			logger.Error("failed to dead-letter invalid records", "bucket", bucket, "key", key, "count", len(invalid), "error", err)
+			pool.fail(fmt.Errorf("%d invalid records in %s could not be dead-lettered: %w", len(invalid), source.location, err))
+		}
+	}
+	result := recordsResult{records: recordCount, submitWait: submitWait}
+	if abandonErr != nil {
+		// 포기하기 전에 읽은 레코드는 색인되므로 일부만 색인된 파일로 표시합니다.
+		pool.metrics.filePartial(bucket, key)
+		logger.Error("file abandoned", "bucket", bucket, "key", key, "format", format,
+			"record_count", recordCount, "record_errors", recordErrors, "error", abandonErr)
+		result.err = fmt.Errorf("%s abandoned: %w", source.location, abandonErr)
+		return result
+	}
+	if stopped {
+		pool.metrics.filePartial(bucket, key)
+		logger.Warn("file interrupted by shutdown", "bucket", bucket, "key", key, "format", format, "record_count", recordCount)
+		result.err = fmt.Errorf("%s interrupted by shutdown after %d records", source.location, recordCount)
+		return result
+	}
+	if readErr != nil {
+		// 일부만 색인된 파일은 성공으로 오해하지 않도록 요약에 표시하고 오류를 반환합니다.
+		pool.metrics.filePartial(bucket, key)
+		logger.Error("file partially ingested", "bucket", bucket, "key", key, "format", format,
+			"record_count", recordCount, "record_errors", recordErrors, "error", readErr)
+		result.err = fmt.Errorf("%s partially ingested: reader failed after %d records: %w", source.location, recordCount, readErr)
+		return result
+	}
+	// 스키마 헤더만 있는 파일은 정상 처리와 구분할 수 있도록 따로 알립니다.
+	if recordCount == 0 {
+		logger.Warn("file contains no records", "bucket", bucket, "key", key, "format", format)
+		if !opts.allowEmptyFiles {
+			result.err = fmt.Errorf("%s contains no records", source.location)
+			return result
+		}
+	}
+	logger.Info("file processed", "bucket", bucket, "key", key, "format", format, "record_count", recordCount, "record_errors", recordErrors, "records_invalid", len(invalid))
+	return result
 }
 
 func main() {
+	// -file을 주면 Lambda 대신 로컬 파일을 바로 색인합니다.
+	file := flag.String("file", "", "index a local Avro OCF or NDJSON file instead of starting the Lambda handler")
+	openSearchURL := flag.String("url", "", "OpenSearch URL for -file (defaults to OPENSEARCH_URL)")
+	flag.Parse()
+	if *file != "" {
+		os.Exit(runLocal(context.Background(), *file, *openSearchURL, os.Stdout))
+	}
+
+	// 설정이 잘못되면 초기화 단계에서 바로 실패시켜 원인을 알기 쉽게 합니다.
+	if err := validateConfig(); err != nil {
+		logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	// HandleRequest가 error를 반환하므로 실패한 호출은 Lambda 재시도/DLQ 대상이 됩니다.
 	lambda.Start(HandleRequest)
 }
@@ -1,60 +1,873 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/linkedin/goavro/v2"
 )
 
-func TestHandler(t *testing.T) {
+// setenv는 테스트 동안 환경 변수를 설정하고 종료 시 원래 값으로 되돌립니다.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	prev, had := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	t.Cleanup(func() {
+		if had {
+			os.Setenv(key, prev)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+func TestResolveRegion(t *testing.T) {
 	testCases := []struct {
-		name          string
-		request       events.APIGatewayProxyRequest
-		expectedBody  string
-		expectedError error
+		name           string
+		awsRegion      string
+		defaultRegion  string
+		expectedRegion string
 	}{
 		{
-			// mock a request with an empty SourceIP
-			name: "empty IP",
-			request: events.APIGatewayProxyRequest{
-				RequestContext: events.APIGatewayProxyRequestContext{
-					Identity: events.APIGatewayRequestIdentity{
-						SourceIP: "",
-					},
-				},
-			},
-			expectedBody:  "Hello, world!\n",
-			expectedError: nil,
+			name:           "AWS_REGION set",
+			awsRegion:      "us-east-1",
+			defaultRegion:  "eu-west-1",
+			expectedRegion: "us-east-1",
 		},
 		{
-			// mock a request with a localhost SourceIP
-			name: "localhost IP",
-			request: events.APIGatewayProxyRequest{
-				RequestContext: events.APIGatewayProxyRequestContext{
-					Identity: events.APIGatewayRequestIdentity{
-						SourceIP: "127.0.0.1",
-					},
-				},
+			name:           "fallback to AWS_DEFAULT_REGION",
+			defaultRegion:  "eu-west-1",
+			expectedRegion: "eu-west-1",
+		},
+		{
+			name:           "neither set",
+			expectedRegion: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "AWS_REGION", testCase.awsRegion)
+			setenv(t, "AWS_DEFAULT_REGION", testCase.defaultRegion)
+
+			region := resolveRegion()
+			if region != testCase.expectedRegion {
+				t.Errorf("Expected region %q, but got %q", testCase.expectedRegion, region)
+			}
+		})
+	}
+}
+
+// testProductSchema는 실제 상품 피드와 같은 형태(nullable union 포함)의 Avro 스키마입니다.
+const testProductSchema = `{
+	"type": "record",
+	"name": "Product",
+	"fields": [
+		{"name": "productId", "type": ["null", "string"]},
+		{"name": "title", "type": "string"},
+		{"name": "price", "type": ["null", "string"]},
+		{"name": "stock", "type": ["null", "long"]}
+	]
+}`
+
+// writeOCF는 주어진 스키마와 레코드로 메모리 안에 OCF 파일을 만듭니다.
+// testConfig는 테스트가 setenv로 바꾼 환경 변수로 핸들러 설정을 만듭니다.
+func testConfig(t testing.TB) handlerConfig {
+	t.Helper()
+	config, err := configFromEnv()
+	if err != nil {
+		t.Fatalf("Expected a valid config, but got %v", err)
+	}
+	return config
+}
+
+func writeOCF(t *testing.T, schema string, records ...map[string]interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Schema: schema})
+	if err != nil {
+		t.Fatalf("Expected OCF writer, but got %v", err)
+	}
+	// 레코드가 없으면 스키마 헤더만 씁니다. (goavro는 빈 Append도 개수 0인 블록으로 쓰는데, 읽을 때는 손상으로 봅니다.)
+	if len(records) == 0 {
+		return buf.Bytes()
+	}
+	data := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		data = append(data, record)
+	}
+	if err := w.Append(data); err != nil {
+		t.Fatalf("Expected records to be appended, but got %v", err)
+	}
+	return buf.Bytes()
+}
+
+// fakeS3는 메모리에 저장된 객체를 반환하는 S3Getter입니다.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	inputs  []*s3.GetObjectInput
+	// 객체를 돌려주기 전에 차례로 반환할 오류
+	failures []error
+	// 0보다 크면 응답마다 본문을 이만큼 돌려준 뒤 연결이 끊긴 것처럼 오류를 반환합니다.
+	disconnectAfter int
+}
+
+// errConnectionReset은 fakeS3가 본문을 읽는 중 연결이 끊겼을 때 반환하는 오류입니다.
+var errConnectionReset = errors.New("read: connection reset by peer")
+
+// disconnectingReader는 limit 바이트를 읽은 뒤 errConnectionReset을 반환합니다.
+type disconnectingReader struct {
+	r     io.Reader
+	limit int
+}
+
+func (d *disconnectingReader) Read(p []byte) (int, error) {
+	if d.limit <= 0 {
+		return 0, errConnectionReset
+	}
+	if len(p) > d.limit {
+		p = p[:d.limit]
+	}
+	n, err := d.r.Read(p)
+	d.limit -= n
+	return n, err
+}
+
+func (f *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inputs = append(f.inputs, input)
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		return nil, err
+	}
+
+	body, ok := f.objects[aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	size := len(body)
+	if rangeHeader := aws.StringValue(input.Range); rangeHeader != "" {
+		var start int
+		fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+		body = body[start:]
+	}
+	var reader io.Reader = bytes.NewReader(body)
+	if f.disconnectAfter > 0 && len(body) > f.disconnectAfter {
+		reader = &disconnectingReader{r: reader, limit: f.disconnectAfter}
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(reader),
+		ContentLength: aws.Int64(int64(len(body))),
+		ETag:          aws.String(fmt.Sprintf("\"%d\"", size)),
+	}, nil
+}
+
+// bulkRecorder는 _bulk 요청 본문을 기록하고 모두 성공으로 응답하는 테스트 서버입니다.
+type bulkRecorder struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests [][]byte
+}
+
+func newBulkRecorder(t *testing.T) *bulkRecorder {
+	t.Helper()
+	recorder := &bulkRecorder{}
+	recorder.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recorder.mu.Lock()
+		recorder.requests = append(recorder.requests, body)
+		recorder.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	t.Cleanup(recorder.Close)
+	return recorder
+}
+
+// documents는 기록된 모든 _bulk 요청에서 액션 줄과 문서 줄을 쌍으로 꺼냅니다.
+func (r *bulkRecorder) documents(t *testing.T) (actions, docs []map[string]interface{}) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, body := range r.requests {
+		lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+		for i := 0; i+1 < len(lines); i += 2 {
+			var action, doc map[string]interface{}
+			if err := json.Unmarshal(lines[i], &action); err != nil {
+				t.Fatalf("Expected JSON action line, but got %s", lines[i])
+			}
+			if err := json.Unmarshal(lines[i+1], &doc); err != nil {
+				t.Fatalf("Expected JSON document line, but got %s", lines[i+1])
+			}
+			actions = append(actions, action)
+			docs = append(docs, doc)
+		}
+	}
+	return actions, docs
+}
+
+// s3Event는 주어진 버킷/키의 ObjectCreated 이벤트를 만듭니다.
+func s3Event(bucket string, keys ...string) events.S3Event {
+	var event events.S3Event
+	for _, key := range keys {
+		event.Records = append(event.Records, events.S3EventRecord{
+			EventName: "ObjectCreated:Put",
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{Name: bucket},
+				Object: events.S3Object{Key: key},
 			},
-			expectedBody:  "Hello, 127.0.0.1!\n",
-			expectedError: nil,
+		})
+	}
+	return event
+}
+
+func TestHandlerEndToEnd(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema,
+		map[string]interface{}{
+			"productId": goavro.Union("string", "p1"),
+			"title":     "무선 이어폰",
+			"price":     goavro.Union("string", "19900"),
+			"stock":     goavro.Union("long", int64(3)),
+		},
+		map[string]interface{}{
+			"productId": goavro.Union("string", "p2"),
+			"title":     "충전기",
+			"price":     goavro.Union("string", "9900.5"),
+			"stock":     nil,
+		},
+	)
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/products/2024/01.avro": ocf}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "products/2024/01.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	actions, docs := recorder.documents(t)
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents, but got %d", len(docs))
+	}
+	index := actions[0]["index"].(map[string]interface{})
+	if index["_index"] != "products" || index["_id"] != "p1" {
+		t.Errorf("Expected products/p1 action, but got %v", index)
+	}
+	if docs[0]["price"] != float64(19900) || docs[0]["stock"] != float64(3) || docs[0]["title"] != "무선 이어폰" {
+		t.Errorf("Expected normalized first document, but got %v", docs[0])
+	}
+	if docs[1]["price"] != 9900.5 || docs[1]["stock"] != nil {
+		t.Errorf("Expected normalized second document, but got %v", docs[1])
+	}
+}
+
+func TestHandlerUsesConfigFromConstruction(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema, productRecords(1)...)
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/a.avro": ocf}}
+	recorder := newBulkRecorder(t)
+
+	// 핸들러를 만든 뒤 바뀐 환경 변수는 호출에 영향을 주지 않습니다.
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	setenv(t, "OP_TYPE", "upsert")
+	setenv(t, "ID_FIELD", "missing")
+	setenv(t, "BATCH_SIZE", "0")
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "a.avro"))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if summary.DocumentsIndexed != 1 {
+		t.Errorf("Expected 1 indexed document, but got %d", summary.DocumentsIndexed)
+	}
+}
+
+func TestHandlerAddsIngestMetadata(t *testing.T) {
+	setenv(t, "ADD_INGEST_METADATA", "true")
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"feed-bucket/a.avro": writeOCF(t, testProductSchema, productRecords(1)...),
+		"feed-bucket/b.avro": writeOCF(t, testProductSchema, productRecords(1)...),
+	}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "a.avro", "b.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	_, docs := recorder.documents(t)
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents, but got %d", len(docs))
+	}
+	for i, expectedKey := range []string{"a.avro", "b.avro"} {
+		if docs[i]["@source_key"] != expectedKey {
+			t.Errorf("Expected @source_key %s, but got %v", expectedKey, docs[i]["@source_key"])
+		}
+		ingestedAt, _ := docs[i]["@ingested_at"].(string)
+		if parsed, err := time.Parse(time.RFC3339, ingestedAt); err != nil || parsed.Location() != time.UTC {
+			t.Errorf("Expected an RFC3339 UTC @ingested_at, but got %q", ingestedAt)
+		}
+	}
+}
+
+func TestHandlerTagsSchemaFingerprint(t *testing.T) {
+	setenv(t, "TAG_SCHEMA", "true")
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"feed-bucket/a.avro":   writeOCF(t, testProductSchema, productRecords(1)...),
+		"feed-bucket/b.ndjson": []byte(`{"productId":"json-1","title":"충전기"}` + "\n"),
+	}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "a.avro", "b.ndjson")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	_, docs := recorder.documents(t)
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents, but got %d", len(docs))
+	}
+	if docs[0]["_schema_fingerprint"] != "f169c23a4ef7bc9c" {
+		t.Errorf("Expected the writer schema fingerprint, but got %v", docs[0]["_schema_fingerprint"])
+	}
+	// NDJSON 파일에는 writer 스키마가 없습니다.
+	if fingerprint, ok := docs[1]["_schema_fingerprint"]; ok {
+		t.Errorf("Expected no fingerprint for NDJSON records, but got %v", fingerprint)
+	}
+}
+
+func TestHandlerReturnsS3Errors(t *testing.T) {
+	recorder := newBulkRecorder(t)
+	h := &handler{config: testConfig(t), s3: &fakeS3{}, openSearch: testClient(t, recorder.URL)}
+
+	_, err := h.handle(context.Background(), s3Event("feed-bucket", "missing.avro"))
+	if err == nil {
+		t.Fatalf("Expected an error for a missing object")
+	}
+	if len(recorder.requests) != 0 {
+		t.Errorf("Expected no bulk requests, but got %d", len(recorder.requests))
+	}
+}
+
+func TestHandlerReadsGzippedAvro(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema, map[string]interface{}{
+		"productId": goavro.Union("string", "p1"),
+		"title":     "무선 이어폰",
+		"price":     goavro.Union("string", "19900"),
+		"stock":     nil,
+	})
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(ocf)
+	zw.Close()
+
+	// 키 접미사가 없어도 매직 바이트로 gzip을 인식해야 합니다.
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"feed-bucket/a.avro.gz": compressed.Bytes(),
+		"feed-bucket/b.avro":    compressed.Bytes(),
+		"feed-bucket/c.avro":    ocf,
+	}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "a.avro.gz", "b.avro", "c.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	_, docs := recorder.documents(t)
+	if len(docs) != 3 {
+		t.Fatalf("Expected 3 documents, but got %d", len(docs))
+	}
+}
+
+func TestHandlerReportsCorruptGzip(t *testing.T) {
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"feed-bucket/broken.avro.gz": {0x1f, 0x8b, 0x00, 0x01},
+	}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "broken.avro.gz")); err == nil {
+		t.Errorf("Expected an error for a corrupt gzip object")
+	}
+}
+
+func TestHandlerReportsPartiallyIngestedFile(t *testing.T) {
+	// 블록 두 개짜리 OCF를 만든 뒤 두 번째 블록 중간을 잘라 손상된 파일을 흉내 냅니다.
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Schema: testProductSchema})
+	if err != nil {
+		t.Fatalf("Expected OCF writer, but got %v", err)
+	}
+	records := productRecords(5)
+	for _, block := range [][]map[string]interface{}{records[:3], records[3:]} {
+		data := make([]interface{}, 0, len(block))
+		for _, record := range block {
+			data = append(data, record)
+		}
+		if err := w.Append(data); err != nil {
+			t.Fatalf("Expected records to be appended, but got %v", err)
+		}
+	}
+	corrupt := buf.Bytes()[:buf.Len()-20]
+
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/corrupt.avro": corrupt}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "corrupt.avro"))
+	if err == nil || !strings.Contains(err.Error(), "s3://feed-bucket/corrupt.avro partially ingested: reader failed after 3 records: block 2:") {
+		t.Fatalf("Expected a partial ingestion error naming the block, but got %v", err)
+	}
+	// 손상 전까지 읽은 레코드는 색인되어야 합니다.
+	if _, docs := recorder.documents(t); len(docs) != 3 {
+		t.Errorf("Expected 3 documents, but got %d", len(docs))
+	}
+	file := summary.Files["feed-bucket/corrupt.avro"]
+	if file == nil || !file.Partial || file.RecordsRead != 3 || file.DocumentsIndexed != 3 {
+		t.Errorf("Expected a partial file summary with 3 records, but got %+v", file)
+	}
+}
+
+func TestHandlerWrapsOCFErrorsWithKey(t *testing.T) {
+	valid := writeOCF(t, testProductSchema, productRecords(2)...)
+
+	testCases := []struct {
+		name     string
+		key      string
+		body     []byte
+		expected []string
+	}{
+		{
+			name:     "not an OCF file",
+			key:      "products/2024/garbage.avro",
+			body:     []byte("definitely not avro"),
+			expected: []string{"s3://feed-bucket/products/2024/garbage.avro", "error creating OCF reader"},
+		},
+		{
+			name:     "truncated block",
+			key:      "products/2024/truncated.avro",
+			body:     valid[:len(valid)-20],
+			expected: []string{"s3://feed-bucket/products/2024/truncated.avro", "block 1:"},
 		},
 	}
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			response, err := handler(testCase.request)
-			if err != testCase.expectedError {
-				t.Errorf("Expected error %v, but got %v", testCase.expectedError, err)
+			s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/" + testCase.key: testCase.body}}
+			recorder := newBulkRecorder(t)
+
+			h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+			_, err := h.handle(context.Background(), s3Event("feed-bucket", testCase.key))
+			for _, expected := range testCase.expected {
+				if err == nil || !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error containing %q, but got %v", expected, err)
+				}
 			}
+		})
+	}
+}
+
+func TestHandlerSkipsInvalidRecords(t *testing.T) {
+	body := "{\"productId\":\"p1\"}\nnot json\n[1,2]\n{\"productId\":\"p2\"}\n"
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.ndjson": []byte(body)}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.ndjson"))
+	if err != nil {
+		t.Fatalf("Expected invalid lines to be skipped, but got %v", err)
+	}
+	if _, docs := recorder.documents(t); len(docs) != 2 {
+		t.Errorf("Expected 2 documents, but got %d", len(docs))
+	}
+	file := summary.Files["feed-bucket/feed.ndjson"]
+	if summary.RecordErrors != 2 || file.RecordErrors != 2 || file.Partial {
+		t.Errorf("Expected 2 record errors on a complete file, but got %+v", file)
+	}
+}
+
+func TestHandlerAbandonsFileAfterMaxRecordErrors(t *testing.T) {
+	setenv(t, "MAX_RECORD_ERRORS", "2")
+	body := "{\"productId\":\"p1\"}\nnot json\nstill not json\nagain not json\n{\"productId\":\"p2\"}\n"
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.ndjson": []byte(body)}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.ndjson"))
+	if err == nil || !strings.Contains(err.Error(), "s3://feed-bucket/feed.ndjson abandoned: 3 of 4 records failed to decode") {
+		t.Fatalf("Expected the file to be abandoned, but got %v", err)
+	}
+	// 포기하기 전에 읽은 레코드는 색인하고, 그 뒤의 레코드는 읽지 않습니다.
+	if _, docs := recorder.documents(t); len(docs) != 1 {
+		t.Errorf("Expected 1 document, but got %d", len(docs))
+	}
+	file := summary.Files["feed-bucket/feed.ndjson"]
+	if file.RecordErrors != 3 || !file.Partial {
+		t.Errorf("Expected 3 record errors on a partial file, but got %+v", file)
+	}
+}
+
+// streamS3는 body가 주는 대로 객체 본문을 흘려보내는 S3 클라이언트입니다.
+type streamS3 struct {
+	body io.ReadCloser
+}
+
+func (f streamS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: f.body}, nil
+}
 
-			if response.Body != testCase.expectedBody {
-				t.Errorf("Expected response %v, but got %v", testCase.expectedBody, response.Body)
+func TestHandlerFlushesBatchOnStop(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "100")
+	pr, pw := io.Pipe()
+	stop := make(chan struct{})
+	go func() {
+		// 두 레코드를 넘긴 뒤 종료를 요청하고, 핸들러가 본문을 닫을 때까지 계속 씁니다.
+		pw.Write([]byte("{\"productId\":\"p1\"}\n"))
+		pw.Write([]byte("{\"productId\":\"p2\"}\n"))
+		close(stop)
+		for i := 3; ; i++ {
+			if _, err := fmt.Fprintf(pw, "{\"productId\":\"p%d\"}\n", i); err != nil {
+				return
 			}
+		}
+	}()
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: streamS3{body: pr}, openSearch: testClient(t, recorder.URL), stop: stop}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.ndjson", "next.ndjson"))
+	if err == nil || !strings.Contains(err.Error(), "interrupted by shutdown") {
+		t.Fatalf("Expected the file to be interrupted, but got %v", err)
+	}
+	// 배치가 가득 차지 않았어도 이미 읽은 레코드는 색인합니다.
+	_, docs := recorder.documents(t)
+	if summary.RecordsRead < 2 || summary.RecordsRead > 3 || len(docs) != summary.RecordsRead {
+		t.Errorf("Expected the records read before the stop to be flushed, but got %d read and %d indexed", summary.RecordsRead, len(docs))
+	}
+	if !summary.Files["feed-bucket/feed.ndjson"].Partial {
+		t.Errorf("Expected the interrupted file to be partial, but got %+v", summary.Files["feed-bucket/feed.ndjson"])
+	}
+	if _, ok := summary.Files["feed-bucket/next.ndjson"]; ok {
+		t.Errorf("Expected the next object not to be processed after the stop")
+	}
+}
+
+func TestHandlerFlushesPartialBatchAfterInterval(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "100")
+	setenv(t, "FLUSH_INTERVAL", "20ms")
+	recorder := newBulkRecorder(t)
+	requests := func() int {
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		return len(recorder.requests)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		// 두 레코드를 넘긴 뒤 배치가 차지 않은 채로 색인될 때까지 더 쓰지 않습니다.
+		pw.Write([]byte("{\"productId\":\"p1\"}\n{\"productId\":\"p2\"}\n"))
+		for deadline := time.Now().Add(2 * time.Second); requests() == 0 && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+		pw.Write([]byte("{\"productId\":\"p3\"}\n"))
+		pw.Close()
+	}()
+
+	h := &handler{config: testConfig(t), s3: streamS3{body: pr}, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.ndjson")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
 
-			if response.StatusCode != 200 {
-				t.Errorf("Expected status code 200, but got %v", response.StatusCode)
+	recorder.mu.Lock()
+	bodies := recorder.requests
+	recorder.mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("Expected the partial batch and the rest as 2 requests, but got %d", len(bodies))
+	}
+	if !bytes.Contains(bodies[0], []byte(`"p2"`)) || bytes.Contains(bodies[0], []byte(`"p3"`)) {
+		t.Errorf("Expected p1 and p2 to be flushed before p3 arrived, but got %s", bodies[0])
+	}
+	if !bytes.Contains(bodies[1], []byte(`"p3"`)) {
+		t.Errorf("Expected p3 in the last batch, but got %s", bodies[1])
+	}
+}
+
+func TestHandlerSkipsRemovedObjects(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema, productRecords(1)...)
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/created.avro": ocf}}
+	recorder := newBulkRecorder(t)
+
+	event := s3Event("feed-bucket", "deleted.avro", "expired.avro", "created.avro")
+	event.Records[0].EventName = "ObjectRemoved:Delete"
+	event.Records[1].EventName = "ObjectRemoved:DeleteMarkerCreated"
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), event); err != nil {
+		t.Fatalf("Expected removed objects to be skipped, but got %v", err)
+	}
+	if len(s3Client.inputs) != 1 || aws.StringValue(s3Client.inputs[0].Key) != "created.avro" {
+		t.Errorf("Expected only created.avro to be fetched, but got %v", s3Client.inputs)
+	}
+	if _, docs := recorder.documents(t); len(docs) != 1 {
+		t.Errorf("Expected 1 document, but got %d", len(docs))
+	}
+}
+
+func TestHandlerFetchesEventVersion(t *testing.T) {
+	ocf := writeOCF(t, testProductSchema, productRecords(1)...)
+	s3Client := &fakeS3{objects: map[string][]byte{
+		"feed-bucket/versioned.avro":   ocf,
+		"feed-bucket/unversioned.avro": ocf,
+	}}
+	recorder := newBulkRecorder(t)
+
+	event := s3Event("feed-bucket", "versioned.avro", "unversioned.avro")
+	event.Records[0].S3.Object.VersionID = "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY"
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), event); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	versions := make(map[string]*string)
+	for _, input := range s3Client.inputs {
+		versions[aws.StringValue(input.Key)] = input.VersionId
+	}
+	if got := aws.StringValue(versions["versioned.avro"]); got != "3HL4kqtJlcpXroDTDmJ.rmSpXd3dIbrHY" {
+		t.Errorf("Expected the event's VersionId to be forwarded, but got %q", got)
+	}
+	if versions["unversioned.avro"] != nil {
+		t.Errorf("Expected no VersionId without one in the event, but got %q", aws.StringValue(versions["unversioned.avro"]))
+	}
+}
+
+func TestHandlerDecodesObjectKeys(t *testing.T) {
+	key := "상품 목록/2024 01월 (최종).avro"
+	ocf := writeOCF(t, testProductSchema, productRecords(1)...)
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/" + key: ocf}}
+	recorder := newBulkRecorder(t)
+
+	// S3 알림은 공백을 "+"로, 한글과 특수 문자를 "%XX"로 인코딩합니다.
+	encoded := strings.ReplaceAll(url.QueryEscape(key), "%2F", "/")
+	if encoded != "%EC%83%81%ED%92%88+%EB%AA%A9%EB%A1%9D/2024+01%EC%9B%94+%28%EC%B5%9C%EC%A2%85%29.avro" {
+		t.Fatalf("Expected an S3-style encoded key, but got %s", encoded)
+	}
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", encoded)); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if got := aws.StringValue(s3Client.inputs[0].Key); got != key {
+		t.Errorf("Expected decoded key %q, but got %q", key, got)
+	}
+}
+
+func TestHandlerEmptyFiles(t *testing.T) {
+	testCases := []struct {
+		name      string
+		allow     string
+		expectErr bool
+	}{
+		{name: "allowed by default", allow: ""},
+		{name: "allowed explicitly", allow: "true"},
+		{name: "rejected", allow: "false", expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "ALLOW_EMPTY_FILES", testCase.allow)
+			// 스키마 헤더만 있는 OCF 파일
+			s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/empty.avro": writeOCF(t, testProductSchema)}}
+			recorder := newBulkRecorder(t)
+
+			h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+			_, err := h.handle(context.Background(), s3Event("feed-bucket", "empty.avro"))
+			if testCase.expectErr {
+				if err == nil || !strings.Contains(err.Error(), "s3://feed-bucket/empty.avro contains no records") {
+					t.Errorf("Expected an empty file error, but got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			if len(recorder.requests) != 0 {
+				t.Errorf("Expected no bulk requests, but got %d", len(recorder.requests))
+			}
+		})
+	}
+}
+
+// nilBodyS3는 오류 없이 본문이 없는 응답을 돌려주는 S3 클라이언트입니다.
+type nilBodyS3 struct{}
+
+func (nilBodyS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{}, nil
+}
+
+func TestHandlerNilOrEmptyBody(t *testing.T) {
+	testCases := []struct {
+		name      string
+		s3        S3Getter
+		allow     string
+		expectErr string
+	}{
+		{name: "nil body", s3: nilBodyS3{}, expectErr: "s3://feed-bucket/products.avro: response has no body"},
+		{name: "zero-byte object", s3: &fakeS3{objects: map[string][]byte{"feed-bucket/products.avro": {}}}},
+		{name: "zero-byte object rejected", s3: &fakeS3{objects: map[string][]byte{"feed-bucket/products.avro": {}}}, allow: "false", expectErr: "s3://feed-bucket/products.avro is empty"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "ALLOW_EMPTY_FILES", testCase.allow)
+			recorder := newBulkRecorder(t)
+
+			h := &handler{config: testConfig(t), s3: testCase.s3, openSearch: testClient(t, recorder.URL)}
+			summary, err := h.handle(context.Background(), s3Event("feed-bucket", "products.avro"))
+			if testCase.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectErr) {
+					t.Errorf("Expected error containing %q, but got %v", testCase.expectErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			if summary.RecordsRead != 0 || len(recorder.requests) != 0 {
+				t.Errorf("Expected nothing indexed, but got %+v (%d bulk requests)", summary, len(recorder.requests))
+			}
+		})
+	}
+}
+
+func TestHandlerReturnsSummary(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "2")
+	records := productRecords(4)
+	// ID가 없는 레코드 하나
+	records[3]["productId"] = nil
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": writeOCF(t, testProductSchema, records...)}}
+	recorder := newBulkRecorder(t)
+
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	summary, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro", "missing.avro"))
+	if err == nil {
+		t.Fatalf("Expected an error for the missing object")
+	}
+
+	expected := InvocationSummary{
+		Version:          summaryVersion,
+		RecordsRead:      4,
+		DocumentsIndexed: 3,
+		RecordsSkipped:   1,
+		BatchesSent:      2,
+		SkipReasons:      map[string]int{skipMissingID: 1},
+		Files: map[string]*FileSummary{
+			"feed-bucket/feed.avro": {RecordsRead: 4, DocumentsIndexed: 3, RecordsSkipped: 1, BatchesSent: 2, SkipReasons: map[string]int{skipMissingID: 1}},
+			"feed-bucket/missing.avro": {
+				Error: summary.Files["feed-bucket/missing.avro"].Error,
+			},
+		},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		encoded, _ := json.Marshal(summary)
+		t.Errorf("Expected summary %+v, but got %s", expected, encoded)
+	}
+	if !strings.Contains(summary.Files["feed-bucket/missing.avro"].Error, "NoSuchKey") {
+		t.Errorf("Expected the missing file error in the summary, but got %q", summary.Files["feed-bucket/missing.avro"].Error)
+	}
+
+	// Step Functions에서 읽는 JSON 필드 이름은 바뀌면 안 됩니다.
+	encoded, _ := json.Marshal(summary)
+	var decoded map[string]interface{}
+	json.Unmarshal(encoded, &decoded)
+	for _, field := range []string{"version", "recordsRead", "documentsIndexed", "documentsFailed", "recordsSkipped", "batchesSent", "skipReasons", "files"} {
+		if _, ok := decoded[field]; !ok {
+			t.Errorf("Expected JSON field %q, but got %s", field, encoded)
+		}
+	}
+}
+
+func TestParseInvocation(t *testing.T) {
+	testCases := []struct {
+		name            string
+		payload         string
+		expectS3        bool
+		expectedRecords int
+		expectErr       string
+	}{
+		{
+			name:     "S3 event",
+			payload:  `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"feed-bucket"},"object":{"key":"feed.avro"}}}]}`,
+			expectS3: true,
+		},
+		{name: "records array", payload: ` [{"productId":"p1"},{"productId":"p2"}]`, expectedRecords: 2},
+		{name: "empty records array", payload: `[]`},
+		{name: "SQS event", payload: `{"Records":[{"messageId":"m1","body":"{}"}]}`, expectErr: "record 0 has no s3 field"},
+		{name: "object without Records", payload: `{"productId":"p1"}`, expectErr: "unsupported event"},
+		{name: "invalid JSON", payload: `[{"productId":`, expectErr: "invalid records payload"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s3Event, records, err := parseInvocation([]byte(testCase.payload))
+			if testCase.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), testCase.expectErr) {
+					t.Errorf("Expected error containing %q, but got %v", testCase.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if (s3Event != nil) != testCase.expectS3 {
+				t.Errorf("Expected S3 event %v, but got %+v", testCase.expectS3, s3Event)
+			}
+			if s3Event != nil && s3Event.Records[0].S3.Object.Key != "feed.avro" {
+				t.Errorf("Expected the object key to be parsed, but got %+v", s3Event.Records[0])
+			}
+			if len(records) != testCase.expectedRecords {
+				t.Errorf("Expected %d records, but got %d", testCase.expectedRecords, len(records))
 			}
 		})
 	}
 }
+
+func TestHandlerIndexesDirectPayload(t *testing.T) {
+	setenv(t, "ADD_INGEST_METADATA", "true")
+	recorder := newBulkRecorder(t)
+	h := &handler{config: testConfig(t), s3: &fakeS3{}, openSearch: testClient(t, recorder.URL)}
+
+	payload := `[{"productId":"p1","price":"19900"},"not a record",{"productId":"p2"}]`
+	summary, err := h.handleInvocation(context.Background(), []byte(payload))
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	_, docs := recorder.documents(t)
+	if len(docs) != 2 || docs[0]["productId"] != "p1" || docs[0]["price"] != 19900.0 {
+		t.Fatalf("Expected p1 and p2 normalized and indexed, but got %v", docs)
+	}
+	if docs[0][sourceKeyField] != directInvocationKey {
+		t.Errorf("Expected source key %q, but got %v", directInvocationKey, docs[0][sourceKeyField])
+	}
+	file := summary.Files[directInvocationKey]
+	if file == nil || file.RecordsRead != 2 || file.RecordErrors != 1 || file.DocumentsIndexed != 2 {
+		t.Errorf("Expected 2 records read and 1 record error for the payload, but got %+v", file)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultMetricsNamespace = "OpenSearchProducts"
+
+// metricsOutput은 EMF 로그를 쓸 곳입니다. Lambda에서는 표준 출력이 CloudWatch Logs로 갑니다.
+var metricsOutput io.Writer = os.Stdout
+
+// invocationMetrics는 호출 하나 동안의 색인 지표를 모읍니다. 여러 워커가 동시에 기록합니다.
+type invocationMetrics struct {
+	mu               sync.Mutex
+	documentsIndexed int
+	documentsFailed  int
+	documentsSkipped int
+	// SKIP_EXISTING 사용 시 이미 같은 내용이라 쓰지 않은 문서 수
+	documentsNoop  int
+	batchesFlushed int
+	bytesUploaded  int
+	recordsRead    int
+	recordErrors   int
+	recordsInvalid int
+	// 읽지 못한 레코드를 원인별로 나눈 수: 깨진 데이터, 객체가 아닌 값
+	decodeErrors     int
+	typeAssertErrors int
+	// OpenSearch가 항목 단위로 거부한 문서 수
+	indexItemErrors int
+	// 이유별로 건너뛴 레코드 수
+	skipReasons map[string]int
+	// 단계별 소요 시간의 합
+	downloadDuration time.Duration
+	decodeDuration   time.Duration
+	indexDuration    time.Duration
+	// 파일별 결과 (InvocationSummary용)
+	files map[string]*FileSummary
+	// 파일별 단계별 소요 시간 (로그용)
+	fileTimings map[string]*fileTimings
+}
+
+// record는 bucket/key 파일의 배치 하나 결과를 누적합니다.
+func (m *invocationMetrics) record(bucket, key string, stats bulkStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file := m.file(bucket, key)
+	// 버전이 오래되었거나 이미 있어 무시된 문서도 건너뛴 것으로 셉니다.
+	skipped := len(stats.skipped)
+	indexed := stats.indexed()
+	m.documentsSkipped += skipped
+	file.RecordsSkipped += skipped
+	for _, skip := range stats.skipped {
+		m.skipped(file, skip.Reason, 1)
+	}
+	m.typeAssertErrors += stats.skippedFor(skipNotRecord)
+	m.indexItemErrors += stats.itemErrors
+	if stats.documents == 0 {
+		return
+	}
+	m.documentsIndexed += indexed
+	m.documentsFailed += stats.failed
+	m.documentsNoop += stats.noops
+	m.batchesFlushed++
+	m.bytesUploaded += stats.bytes
+	file.DocumentsIndexed += indexed
+	file.DocumentsFailed += stats.failed
+	file.DocumentsNoop += stats.noops
+	file.BatchesSent++
+}
+
+// recordsUndecoded는 파일 하나에서 읽지 못한 레코드를 원인별로 누적합니다.
+// 데이터 문제(디코딩, 타입 단언)와 OpenSearch 문제(IndexItemErrors)를 지표에서 나눠 볼 수 있게 합니다.
+func (m *invocationMetrics) recordsUndecoded(decodeErrors, typeAssertErrors int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decodeErrors += decodeErrors
+	m.typeAssertErrors += typeAssertErrors
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// emit은 누적한 지표를 CloudWatch Embedded Metric Format 한 줄로 기록합니다.
+// CloudWatch가 로그에서 지표를 추출하므로 별도의 API 호출이나 의존성이 필요 없습니다.
+func (m *invocationMetrics) emit(w io.Writer, namespace, index string, duration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	line := map[string]interface{}{
+		"_aws": emfMetadata{
+			Timestamp: time.Now().UnixMilli(),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  namespace,
+				Dimensions: [][]string{{"Index"}},
+				Metrics: []emfMetric{
+					{Name: "DocumentsIndexed", Unit: "Count"},
+					{Name: "DocumentsFailed", Unit: "Count"},
+					{Name: "DocumentsSkipped", Unit: "Count"},
+					{Name: "BatchesFlushed", Unit: "Count"},
+					{Name: "BytesUploaded", Unit: "Bytes"},
+					{Name: "AvroDecodeErrors", Unit: "Count"},
+					{Name: "TypeAssertErrors", Unit: "Count"},
+					{Name: "IndexItemErrors", Unit: "Count"},
+					{Name: "InvocationDuration", Unit: "Milliseconds"},
+					{Name: "DownloadDuration", Unit: "Milliseconds"},
+					{Name: "DecodeDuration", Unit: "Milliseconds"},
+					{Name: "IndexDuration", Unit: "Milliseconds"},
+				},
+			}},
+		},
+		"Index":              index,
+		"DocumentsIndexed":   m.documentsIndexed,
+		"DocumentsFailed":    m.documentsFailed,
+		"DocumentsSkipped":   m.documentsSkipped,
+		"BatchesFlushed":     m.batchesFlushed,
+		"BytesUploaded":      m.bytesUploaded,
+		"AvroDecodeErrors":   m.decodeErrors,
+		"TypeAssertErrors":   m.typeAssertErrors,
+		"IndexItemErrors":    m.indexItemErrors,
+		"InvocationDuration": float64(duration) / float64(time.Millisecond),
+		"DownloadDuration":   float64(m.downloadDuration) / float64(time.Millisecond),
+		"DecodeDuration":     float64(m.decodeDuration) / float64(time.Millisecond),
+		"IndexDuration":      float64(m.indexDuration) / float64(time.Millisecond),
+	}
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(encoded, '\n'))
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInvocationMetricsEmit(t *testing.T) {
+	var metrics invocationMetrics
+	metrics.record("feed-bucket", "feed.avro", bulkStats{documents: 10, failed: 2, bytes: 1000, itemErrors: 2})
+	metrics.record("feed-bucket", "feed.avro", bulkStats{documents: 5, bytes: 400})
+	// 문서가 없는 배치는 건너뛴 레코드만 셉니다.
+	metrics.record("feed-bucket", "feed.avro", bulkStats{skipped: []SkipReason{{Reason: skipMissingID}, {Reason: skipMissingID}, {Reason: skipNotRecord}}})
+	metrics.recordsUndecoded(4, 1)
+
+	var out bytes.Buffer
+	if err := metrics.emit(&out, "OpenSearchProducts", "products", 1500*time.Millisecond); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var line struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		Index              string
+		DocumentsIndexed   int
+		DocumentsFailed    int
+		DocumentsSkipped   int
+		BatchesFlushed     int
+		BytesUploaded      int
+		AvroDecodeErrors   int
+		TypeAssertErrors   int
+		IndexItemErrors    int
+		InvocationDuration float64
+	}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON line, but got %s", out.Bytes())
+	}
+	if len(line.AWS.CloudWatchMetrics) != 1 || line.AWS.CloudWatchMetrics[0].Namespace != "OpenSearchProducts" {
+		t.Fatalf("Expected one OpenSearchProducts directive, but got %+v", line.AWS.CloudWatchMetrics)
+	}
+	directive := line.AWS.CloudWatchMetrics[0]
+	if len(directive.Dimensions) != 1 || len(directive.Dimensions[0]) != 1 || directive.Dimensions[0][0] != "Index" {
+		t.Errorf("Expected the Index dimension, but got %v", directive.Dimensions)
+	}
+	if len(directive.Metrics) != 12 {
+		t.Errorf("Expected 12 metric definitions, but got %v", directive.Metrics)
+	}
+	if line.Index != "products" || line.DocumentsIndexed != 13 || line.DocumentsFailed != 2 || line.DocumentsSkipped != 3 ||
+		line.BatchesFlushed != 2 || line.BytesUploaded != 1400 || line.InvocationDuration != 1500 {
+		t.Errorf("Expected accumulated metric values, but got %+v", line)
+	}
+	if line.AvroDecodeErrors != 4 || line.TypeAssertErrors != 2 || line.IndexItemErrors != 2 {
+		t.Errorf("Expected 4 decode, 2 type assertion and 2 index item errors, but got %+v", line)
+	}
+	if line.AWS.Timestamp == 0 {
+		t.Errorf("Expected a timestamp, but got 0")
+	}
+}
+
+func TestHandlerEmitsMetrics(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "2")
+	var out bytes.Buffer
+	previous := metricsOutput
+	metricsOutput = &out
+	t.Cleanup(func() { metricsOutput = previous })
+
+	ocf := writeOCF(t, testProductSchema, productRecords(5)...)
+	recorder := newBulkRecorder(t)
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+		openSearch: testClient(t, recorder.URL),
+	}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("Expected an EMF line, but got %s", out.Bytes())
+	}
+	if line["DocumentsIndexed"] != float64(5) || line["BatchesFlushed"] != float64(3) || line["DocumentsFailed"] != float64(0) {
+		t.Errorf("Expected 5 documents in 3 batches, but got %v", line)
+	}
+	if line["BytesUploaded"].(float64) <= 0 {
+		t.Errorf("Expected uploaded bytes, but got %v", line["BytesUploaded"])
+	}
+}
+
+func TestHandlerEmitsErrorMetricsByCause(t *testing.T) {
+	var out bytes.Buffer
+	previous := metricsOutput
+	metricsOutput = &out
+	t.Cleanup(func() { metricsOutput = previous })
+
+	// 깨진 줄 하나, 객체가 아닌 줄 하나, OpenSearch가 거부하는 문서 하나
+	feed := "{\"productId\":\"p1\"}\n{not json\n[1,2]\n{\"productId\":\"p2\"}\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"errors":true,"items":[
+			{"index":{"_id":"p1","status":201}},
+			{"index":{"_id":"p2","status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`))
+	}))
+	t.Cleanup(server.Close)
+	h := &handler{
+		config:     testConfig(t),
+		s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.ndjson": []byte(feed)}},
+		openSearch: testClient(t, server.URL),
+	}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.ndjson")); err == nil {
+		t.Fatalf("Expected an error for the rejected document, but got nil")
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("Expected an EMF line, but got %s", out.Bytes())
+	}
+	if line["AvroDecodeErrors"] != float64(1) || line["TypeAssertErrors"] != float64(1) || line["IndexItemErrors"] != float64(1) {
+		t.Errorf("Expected one error of each cause, but got %v", line)
+	}
+}
+
+func TestHandlerLogsFileTimings(t *testing.T) {
+	var logs bytes.Buffer
+	previousLogger := logger
+	logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	t.Cleanup(func() { logger = previousLogger })
+
+	ocf := writeOCF(t, testProductSchema, productRecords(3)...)
+	recorder := newBulkRecorder(t)
+	// GetObject가 20ms 걸리는 S3
+	s3Client := &slowS3{fakeS3: &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}}}
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	var timings map[string]interface{}
+	for _, line := range bytes.Split(logs.Bytes(), []byte("\n")) {
+		var entry map[string]interface{}
+		if json.Unmarshal(line, &entry) == nil && entry["msg"] == "file timings" {
+			timings = entry
+		}
+	}
+	if timings == nil {
+		t.Fatalf("Expected a file timings log line, but got %s", logs.Bytes())
+	}
+	if timings["file"] != "feed-bucket/feed.avro" || timings["records"] != float64(3) || timings["bytes"] != float64(len(ocf)) {
+		t.Errorf("Expected timings for feed-bucket/feed.avro with 3 records, but got %v", timings)
+	}
+	if download, _ := timings["download_ms"].(float64); download < 20 {
+		t.Errorf("Expected the GetObject time in download_ms, but got %v", timings["download_ms"])
+	}
+	for _, field := range []string{"decode_ms", "index_ms", "records_per_second"} {
+		if _, ok := timings[field].(float64); !ok {
+			t.Errorf("Expected %s, but got %v", field, timings)
+		}
+	}
+}
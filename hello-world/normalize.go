@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// NUMERIC_FIELDS가 없을 때 숫자로 변환하는 기본 필드
+var defaultNumericFields = []string{"webcastAddSales", "webcastSalesMoney", "price"}
+
+// normalizeOptions는 레코드 정규화 방식을 정합니다.
+type normalizeOptions struct {
+	// 숫자 문자열로 들어와 float64로 변환해야 하는 필드
+	numericFields []string
+	// 중첩 레코드를 점으로 이은 키로 펼칠지 여부
+	flattenNested bool
+	// 문서에 남길 필드 (비어 있으면 모두)와 뺄 필드. 둘 다 있으면 빼는 쪽이 우선합니다.
+	includeFields []string
+	excludeFields []string
+	// 필드 이름 → 대상 타입 (COERCION_CONFIG). numericFields 다음에 적용합니다.
+	coercions map[string]string
+	// Avro 필드 이름 → OpenSearch 필드 이름
+	renames map[string]string
+	// 값이 null인 필드를 문서에서 뺄지 여부
+	omitNulls bool
+	// bytes/fixed 값을 문자열로 바꾸는 방식 (BYTES_ENCODING, 비어 있으면 base64)
+	bytesEncoding string
+	// decimal 값을 숫자와 정확한 10진수 문자열 중 무엇으로 넣을지 (DECIMAL_FORMAT, 비어 있으면 숫자)
+	decimalFormat string
+	// 문자열 값의 최대 바이트 수 (0이면 제한 없음). 넘으면 oversizedAction에 따라 자르거나 뺍니다.
+	maxFieldBytes   int
+	oversizedAction string
+	// @ingested_at, @source_key를 문서에 넣을지 여부
+	ingestMetadata bool
+	// productId로 categoryLabel을 찾을 보강 테이블 (processRecords가 handler에서 채움)
+	enrichment *enrichmentTable
+	// ingestMetadata일 때 넣을 값 (파일마다 processObject가 채움)
+	sourceKey  string
+	ingestedAt string
+	// _schema_fingerprint를 문서에 넣을지 여부 (TAG_SCHEMA)
+	tagSchema bool
+	// tagSchema일 때 넣을 writer 스키마 지문 (Avro 파일마다 processRecords가 채움, 스키마가 없는 형식은 비어 있음)
+	schemaFingerprint string
+	// writer 스키마의 enum, fixed 타입 이름 → "enum" 또는 "fixed" (Avro 파일마다 processRecords가 채움).
+	// union의 enum, fixed branch를 풀 때 씁니다.
+	unionNames map[string]string
+}
+
+// 감사용 수집 메타데이터 필드 이름
+const (
+	ingestedAtField = "@ingested_at"
+	sourceKeyField  = "@source_key"
+	// 문서를 만든 writer 스키마의 지문 필드 이름
+	schemaFingerprintField = "_schema_fingerprint"
+)
+
+// normalizeOptionsFromEnv는 환경 변수에서 정규화 옵션을 읽습니다.
+func normalizeOptionsFromEnv() normalizeOptions {
+	return normalizeOptions{
+		numericFields:   envList("NUMERIC_FIELDS", defaultNumericFields),
+		flattenNested:   envBool("FLATTEN_NESTED", false),
+		includeFields:   envList("INCLUDE_FIELDS", nil),
+		excludeFields:   envList("EXCLUDE_FIELDS", nil),
+		coercions:       coercionsFromEnv(),
+		renames:         fieldRenamesFromEnv(),
+		omitNulls:       envBool("OMIT_NULLS", false),
+		bytesEncoding:   bytesEncodingFromEnv(),
+		decimalFormat:   decimalFormatFromEnv(),
+		maxFieldBytes:   envInt("MAX_FIELD_BYTES", 0),
+		oversizedAction: oversizedFieldActionFromEnv(),
+		ingestMetadata:  envBool("ADD_INGEST_METADATA", false),
+		tagSchema:       envBool("TAG_SCHEMA", false),
+	}
+}
+
+// fieldRenamesFromEnv는 FIELD_RENAMES({"avroField":"osField"})를 읽습니다.
+// 잘못된 JSON이면 경고를 남기고 이름을 바꾸지 않습니다.
+func fieldRenamesFromEnv() map[string]string {
+	value := os.Getenv("FIELD_RENAMES")
+	if value == "" {
+		return nil
+	}
+	var renames map[string]string
+	if err := json.Unmarshal([]byte(value), &renames); err != nil {
+		logger.Warn("invalid FIELD_RENAMES, fields are not renamed", "value", value, "error", err)
+		return nil
+	}
+	// 여러 필드가 같은 이름으로 바뀌면 어느 값이 남을지 알 수 없으므로 미리 알립니다.
+	sources := make(map[string][]string)
+	for from, to := range renames {
+		sources[to] = append(sources[to], from)
+	}
+	for to, from := range sources {
+		if len(from) > 1 {
+			sort.Strings(from)
+			logger.Warn("FIELD_RENAMES maps several fields to the same name", "target", to, "fields", from)
+		}
+	}
+	return renames
+}
+
+// normalizeRecord는 goavro가 디코딩한 레코드를 OpenSearch에 넣기 좋은 형태로 바꿉니다.
+// 전달받은 map을 직접 수정하고 그대로 반환합니다. (flattenNested면 새 map을 반환)
+func normalizeRecord(raw map[string]interface{}, opts normalizeOptions) map[string]interface{} {
+	for key, value := range raw {
+		raw[key] = unwrapValue(value, &opts)
+	}
+	if opts.flattenNested {
+		flattened := make(map[string]interface{}, len(raw))
+		flattenInto(flattened, "", raw, &opts)
+		raw = flattened
+	}
+	raw = projectFields(raw, opts.includeFields, opts.excludeFields)
+	encodeBytesFields(raw, opts.bytesEncoding)
+
+	// 숫자 문자열 필드를 숫자로 변환 (변환할 수 없으면 원래 문자열 유지)
+	for _, field := range opts.numericFields {
+		str, ok := raw[field].(string)
+		if !ok {
+			continue
+		}
+		number, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			logger.Warn("failed to parse numeric field", "field", field, "value", str, "error", err)
+			continue
+		}
+		raw[field] = number
+	}
+	coerceFields(raw, opts.coercions)
+	// 보강은 이름을 바꾸기 전의 productId로 조인합니다.
+	opts.enrichment.enrich(raw)
+
+	renameFields(raw, opts.renames)
+	limitFieldSizes(raw, opts.maxFieldBytes, opts.oversizedAction)
+
+	// null 필드를 빼면 OpenSearch는 해당 필드가 없는 것으로 처리합니다.
+	if opts.omitNulls {
+		for key, value := range raw {
+			if value == nil {
+				delete(raw, key)
+			}
+		}
+	}
+
+	// 어느 파일에서 언제 들어온 문서인지 OpenSearch에서 바로 찾을 수 있게 합니다.
+	if opts.ingestMetadata {
+		raw[ingestedAtField] = opts.ingestedAt
+		raw[sourceKeyField] = opts.sourceKey
+	}
+	// 상류 스키마가 바뀐 뒤에도 이전 스키마로 만든 문서를 찾을 수 있게 합니다.
+	if opts.tagSchema && opts.schemaFingerprint != "" {
+		raw[schemaFingerprintField] = opts.schemaFingerprint
+	}
+	return raw
+}
+
+// projectFields는 레코드를 include에 있는 필드만 남기고 exclude에 있는 필드를 뺍니다.
+// 필드 이름은 원래 레코드 기준이고 FLATTEN_NESTED를 쓰면 펼친 이름("seller.name")입니다.
+// 보강과 수집 메타데이터 필드는 이후에 넣으므로 영향을 받지 않습니다.
+func projectFields(raw map[string]interface{}, include, exclude []string) map[string]interface{} {
+	if len(include) > 0 {
+		projected := make(map[string]interface{}, len(include))
+		for _, field := range include {
+			if value, ok := raw[field]; ok {
+				projected[field] = value
+			}
+		}
+		raw = projected
+	}
+	for _, field := range exclude {
+		delete(raw, field)
+	}
+	return raw
+}
+
+// renameFields는 타입 변환이 끝난 레코드의 필드 이름을 바꿉니다.
+// 바뀐 이름의 필드가 이미 있으면 경고를 남기고 이름을 바꾼 값으로 덮어씁니다.
+func renameFields(raw map[string]interface{}, renames map[string]string) {
+	if len(renames) == 0 {
+		return
+	}
+	renamed := make(map[string]interface{}, len(renames))
+	for from, to := range renames {
+		value, ok := raw[from]
+		if !ok || from == to {
+			continue
+		}
+		delete(raw, from)
+		renamed[to] = value
+	}
+	for to, value := range renamed {
+		if _, exists := raw[to]; exists {
+			logger.Warn("renamed field overwrites an existing field", "field", to)
+		}
+		raw[to] = value
+	}
+}
+
+// unwrapUnion은 nullable union 값을 꺼냅니다.
+// goavro는 union을 {"string": "..."}처럼 타입 이름을 키로 하는 map으로 디코딩합니다.
+// names는 writer 스키마의 record, enum, fixed 타입 전체 이름으로, enum branch({"Status": "ACTIVE"})는 기호 문자열로,
+// fixed branch({"Hash": []byte{...}})와 record branch({"Seller": {...}})는 안의 값으로 풉니다.
+func unwrapUnion(value interface{}, names map[string]string) interface{} {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	if stringValue, ok := valueMap["string"].(string); ok {
+		return stringValue
+	}
+	if longValue, ok := valueMap["long"].(int64); ok {
+		return longValue
+	}
+	if intValue, ok := valueMap["int"].(int32); ok {
+		return intValue
+	}
+	if boolValue, ok := valueMap["boolean"].(bool); ok {
+		return boolValue
+	}
+	if doubleValue, ok := valueMap["double"].(float64); ok {
+		return doubleValue
+	}
+	if floatValue, ok := valueMap["float"].(float32); ok {
+		return floatValue
+	}
+	if bytesValue, ok := valueMap["bytes"].([]byte); ok {
+		return bytesValue
+	}
+	// null branch는 보통 nil로 디코딩되지만, {"null": null}로 들어오면 nil로 바꿉니다.
+	if _, ok := valueMap["null"]; ok && len(valueMap) == 1 {
+		return nil
+	}
+	// 논리 타입 branch는 goavro가 붙이는 이름("long.timestamp-millis", "bytes.decimal" 등)과,
+	// 이름 있는 타입 branch는 스키마의 타입 이름과 비교합니다.
+	// (값이 하나뿐인 map<string>, map<bytes> 필드를 잘못 풀지 않도록 키 모양이 아니라 이름으로만 판단합니다.)
+	if len(valueMap) == 1 {
+		for branch, branchValue := range valueMap {
+			if logicalBranches[branch] {
+				return branchValue
+			}
+			switch names[branch] {
+			case "enum":
+				if symbol, isString := branchValue.(string); isString {
+					return symbol
+				}
+			case "fixed":
+				// fixed.decimal이면 *big.Rat, 아니면 []byte
+				return branchValue
+			case "record":
+				if record, isRecord := branchValue.(map[string]interface{}); isRecord {
+					return record
+				}
+			}
+		}
+	}
+	return value
+}
+
+// goavro가 논리 타입 union branch에 쓰는 이름
+var logicalBranches = map[string]bool{
+	"long.timestamp-millis": true,
+	"long.timestamp-micros": true,
+	"int.time-millis":       true,
+	"long.time-micros":      true,
+	"int.date":              true,
+	"bytes.decimal":         true,
+	"fixed.decimal":         true,
+}
+
+// unwrapValue는 union branch를 풀고 논리 타입을 변환합니다.
+// 배열은 원소마다 같은 방식으로 풀어, union 배열({"string": "a"} 원소)이 객체 배열로 색인되지 않게 합니다.
+func unwrapValue(value interface{}, opts *normalizeOptions) interface{} {
+	value = logicalValue(unwrapUnion(value, opts.unionNames), opts.decimalFormat)
+	items, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	for i, item := range items {
+		items[i] = unwrapValue(item, opts)
+	}
+	return items
+}
+
+// bytes/fixed 값을 문자열로 바꾸는 방식 (BYTES_ENCODING)
+const (
+	bytesBase64 = "base64"
+	bytesHex    = "hex"
+)
+
+// parseBytesEncoding은 BYTES_ENCODING을 읽습니다. 값이 없으면 base64를 씁니다.
+func parseBytesEncoding(value string) (string, error) {
+	switch value {
+	case "":
+		return bytesBase64, nil
+	case bytesBase64, bytesHex:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown BYTES_ENCODING %q (expected %q or %q)", value, bytesBase64, bytesHex)
+}
+
+// bytesEncodingFromEnv는 BYTES_ENCODING을 읽습니다. 잘못된 값은 validateConfig가 시작할 때 막습니다.
+func bytesEncodingFromEnv() string {
+	encoding, err := parseBytesEncoding(os.Getenv("BYTES_ENCODING"))
+	if err != nil {
+		logger.Warn("bytes fields are encoded as base64", "error", err)
+		return bytesBase64
+	}
+	return encoding
+}
+
+// decimal 값을 문서에 넣는 방식 (DECIMAL_FORMAT)
+const (
+	decimalNumber = "number"
+	decimalString = "string"
+)
+
+// parseDecimalFormat은 DECIMAL_FORMAT을 읽습니다. 값이 없으면 숫자로 넣습니다.
+func parseDecimalFormat(value string) (string, error) {
+	switch value {
+	case "":
+		return decimalNumber, nil
+	case decimalNumber, decimalString:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown DECIMAL_FORMAT %q (expected %q or %q)", value, decimalNumber, decimalString)
+}
+
+// decimalFormatFromEnv는 DECIMAL_FORMAT을 읽습니다. 잘못된 값은 validateConfig가 시작할 때 막습니다.
+func decimalFormatFromEnv() string {
+	format, err := parseDecimalFormat(os.Getenv("DECIMAL_FORMAT"))
+	if err != nil {
+		logger.Warn("decimal fields are indexed as numbers", "error", err)
+		return decimalNumber
+	}
+	return format
+}
+
+// exactDecimal은 decimal 값을 지수 없이 정확한 10진수 문자열로 바꿉니다. ("19.90"은 "19.9")
+// Avro decimal은 분모가 10^scale의 약수이므로 분모의 2와 5 인수 개수만큼 소수 자리를 쓰면 정확합니다.
+func exactDecimal(value *big.Rat) string {
+	denominator := new(big.Int).Set(value.Denom())
+	var digits [2]int
+	for i, factor := range []int64{2, 5} {
+		divisor, remainder := big.NewInt(factor), new(big.Int)
+		for {
+			quotient, _ := new(big.Int).QuoRem(denominator, divisor, remainder)
+			if remainder.Sign() != 0 {
+				break
+			}
+			denominator = quotient
+			digits[i]++
+		}
+	}
+	return value.FloatString(max(digits[0], digits[1]))
+}
+
+// encodeBytesFields는 bytes/fixed 값([]byte)을 encoding에 맞는 문자열로 바꿉니다. 중첩 레코드와 배열 안의 값도 바꿉니다.
+// 문자열로 바꿔 두면 MAX_FIELD_BYTES와 검증 규칙이 다른 문자열 필드와 같이 적용됩니다.
+func encodeBytesFields(raw map[string]interface{}, encoding string) {
+	for key, value := range raw {
+		raw[key] = encodeBytesValue(value, encoding)
+	}
+}
+
+func encodeBytesValue(value interface{}, encoding string) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if encoding == bytesHex {
+			return hex.EncodeToString(v)
+		}
+		return base64.StdEncoding.EncodeToString(v)
+	case map[string]interface{}:
+		encodeBytesFields(v, encoding)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = encodeBytesValue(item, encoding)
+		}
+	}
+	return value
+}
+
+// flattenInto는 중첩 레코드를 "seller.name"처럼 점으로 이은 키로 펼쳐 dst에 넣습니다.
+// 배열과 스칼라 값은 그대로 둡니다. Avro 레코드에는 순환이 없으므로 깊이는 스키마로 제한됩니다.
+func flattenInto(dst map[string]interface{}, prefix string, record map[string]interface{}, opts *normalizeOptions) {
+	for key, value := range record {
+		value = unwrapValue(value, opts)
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenInto(dst, prefix+key+".", nested, opts)
+			continue
+		}
+		dst[prefix+key] = value
+	}
+}
+
+// logicalValue는 goavro가 논리 타입으로 디코딩한 값을 JSON으로 보내기 좋은 값으로 바꿉니다.
+// 그대로 직렬화하면 decimal(*big.Rat)은 "3/2" 같은 분수 문자열이 됩니다.
+func logicalValue(value interface{}, decimalFormat string) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		// timestamp-millis/micros, date → ISO-8601 (UTC)
+		return v.UTC().Format(time.RFC3339Nano)
+	case *big.Rat:
+		// decimal → 숫자 (float64 정밀도, 유효 숫자 약 15자리를 넘으면 반올림됨) 또는 정확한 10진수 문자열
+		if decimalFormat == decimalString {
+			return exactDecimal(v)
+		}
+		f, _ := v.Float64()
+		return f
+	case time.Duration:
+		// time-millis/micros → 자정부터의 밀리초
+		return v.Milliseconds()
+	}
+	return value
+}
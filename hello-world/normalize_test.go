@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestNormalizeRecord(t *testing.T) {
+	testCases := []struct {
+		name     string
+		raw      map[string]interface{}
+		opts     normalizeOptions
+		expected map[string]interface{}
+	}{
+		{
+			name: "unwraps string, long and int unions",
+			raw: map[string]interface{}{
+				"productId": map[string]interface{}{"string": "p1"},
+				"stock":     map[string]interface{}{"long": int64(12)},
+				"rank":      map[string]interface{}{"int": int32(3)},
+			},
+			expected: map[string]interface{}{
+				"productId": "p1",
+				"stock":     int64(12),
+				"rank":      int32(3),
+			},
+		},
+		{
+			name: "keeps only included fields",
+			raw: map[string]interface{}{
+				"productId":     map[string]interface{}{"string": "p1"},
+				"title":         "무선 이어폰",
+				"_debug":        "trace",
+				"internalScore": 0.7,
+			},
+			opts: normalizeOptions{includeFields: []string{"productId", "title", "missing"}},
+			expected: map[string]interface{}{
+				"productId": "p1",
+				"title":     "무선 이어폰",
+			},
+		},
+		{
+			name: "drops excluded fields",
+			raw: map[string]interface{}{
+				"productId":     "p1",
+				"title":         "무선 이어폰",
+				"_debug":        "trace",
+				"internalScore": 0.7,
+			},
+			opts: normalizeOptions{excludeFields: []string{"_debug", "internalScore"}},
+			expected: map[string]interface{}{
+				"productId": "p1",
+				"title":     "무선 이어폰",
+			},
+		},
+		{
+			name: "exclude wins over include and applies to flattened names",
+			raw: map[string]interface{}{
+				"productId":     "p1",
+				"internalScore": 0.7,
+				"seller":        map[string]interface{}{"name": "sample-shop", "internalId": "s-1"},
+			},
+			opts: normalizeOptions{
+				flattenNested: true,
+				includeFields: []string{"productId", "internalScore", "seller.name", "seller.internalId"},
+				excludeFields: []string{"internalScore", "seller.internalId"},
+				// 보강 필드는 목록과 상관없이 넣습니다.
+				enrichment: &enrichmentTable{labels: map[string]string{"p1": "audio"}},
+			},
+			expected: map[string]interface{}{
+				"productId":     "p1",
+				"seller.name":   "sample-shop",
+				"categoryLabel": "audio",
+			},
+		},
+		{
+			name: "unwraps each element of arrays of unions",
+			raw: map[string]interface{}{
+				"tags":    []interface{}{map[string]interface{}{"string": "sale"}, nil, map[string]interface{}{"string": "new"}},
+				"sizes":   []interface{}{map[string]interface{}{"long": int64(250)}, map[string]interface{}{"long": int64(260)}},
+				"nested":  []interface{}{[]interface{}{map[string]interface{}{"int": int32(1)}}},
+				"plain":   []interface{}{"a", "b"},
+				"records": []interface{}{map[string]interface{}{"name": "seller"}},
+			},
+			expected: map[string]interface{}{
+				"tags":    []interface{}{"sale", nil, "new"},
+				"sizes":   []interface{}{int64(250), int64(260)},
+				"nested":  []interface{}{[]interface{}{int32(1)}},
+				"plain":   []interface{}{"a", "b"},
+				"records": []interface{}{map[string]interface{}{"name": "seller"}},
+			},
+		},
+		{
+			name: "unwraps boolean, double, float, bytes and null unions",
+			raw: map[string]interface{}{
+				"active":   map[string]interface{}{"boolean": true},
+				"rating":   map[string]interface{}{"double": 4.5},
+				"weight":   map[string]interface{}{"float": float32(1.5)},
+				"thumb":    map[string]interface{}{"bytes": []byte{0x01, 0x02}},
+				"discount": map[string]interface{}{"null": nil},
+				"memo":     nil,
+			},
+			expected: map[string]interface{}{
+				"active":   true,
+				"rating":   4.5,
+				"weight":   float32(1.5),
+				"thumb":    "AQI=",
+				"discount": nil,
+				"memo":     nil,
+			},
+		},
+		{
+			name: "encodes bytes and fixed branches as hex",
+			raw: map[string]interface{}{
+				"thumb":  map[string]interface{}{"bytes": []byte{0xca, 0xfe}},
+				"hash":   map[string]interface{}{"Md5": []byte{0x01, 0xff}},
+				"raw":    []byte{0x00},
+				"chunks": []interface{}{map[string]interface{}{"bytes": []byte{0x0a}}},
+				"seller": map[string]interface{}{"name": "s1", "logo": []byte{0x0b}},
+			},
+			opts: normalizeOptions{bytesEncoding: bytesHex, unionNames: map[string]string{"Md5": "fixed"}},
+			expected: map[string]interface{}{
+				"thumb":  "cafe",
+				"hash":   "01ff",
+				"raw":    "00",
+				"chunks": []interface{}{"0a"},
+				"seller": map[string]interface{}{"name": "s1", "logo": "0b"},
+			},
+		},
+		{
+			name: "omits null fields",
+			raw: map[string]interface{}{
+				"productId": "p1",
+				"discount":  map[string]interface{}{"null": nil},
+				"memo":      nil,
+				"active":    map[string]interface{}{"boolean": false},
+			},
+			opts: normalizeOptions{omitNulls: true},
+			expected: map[string]interface{}{
+				"productId": "p1",
+				"active":    false,
+			},
+		},
+		{
+			name: "parses numeric string fields",
+			raw: map[string]interface{}{
+				"price":             "19900",
+				"webcastSalesMoney": map[string]interface{}{"string": "1234.5"},
+				"webcastAddSales":   "7",
+			},
+			expected: map[string]interface{}{
+				"price":             float64(19900),
+				"webcastSalesMoney": 1234.5,
+				"webcastAddSales":   float64(7),
+			},
+		},
+		{
+			name: "missing fields are left absent",
+			raw: map[string]interface{}{
+				"productId": "p1",
+			},
+			expected: map[string]interface{}{
+				"productId": "p1",
+			},
+		},
+		{
+			name: "non-string numeric inputs are untouched",
+			raw: map[string]interface{}{
+				"price":           float64(100),
+				"webcastAddSales": int64(5),
+			},
+			expected: map[string]interface{}{
+				"price":           float64(100),
+				"webcastAddSales": int64(5),
+			},
+		},
+		{
+			name: "unparseable float strings are kept as strings",
+			raw: map[string]interface{}{
+				"price": "N/A",
+			},
+			expected: map[string]interface{}{
+				"price": "N/A",
+			},
+		},
+		{
+			name: "configured numeric fields replace the defaults",
+			raw: map[string]interface{}{
+				"price":    "100",
+				"discount": "0.15",
+				"stock":    "abc",
+			},
+			opts: normalizeOptions{numericFields: []string{"discount", "stock", "absent"}},
+			expected: map[string]interface{}{
+				"price":    "100",
+				"discount": 0.15,
+				"stock":    "abc",
+			},
+		},
+		{
+			name: "flattens two-level nesting",
+			raw: map[string]interface{}{
+				"productId": "p1",
+				"seller": map[string]interface{}{
+					"name":   map[string]interface{}{"string": "sample-shop"},
+					"rating": 4.5,
+				},
+			},
+			opts: normalizeOptions{flattenNested: true},
+			expected: map[string]interface{}{
+				"productId":     "p1",
+				"seller.name":   "sample-shop",
+				"seller.rating": 4.5,
+			},
+		},
+		{
+			name: "flattens three-level nesting and keeps arrays",
+			raw: map[string]interface{}{
+				"seller": map[string]interface{}{
+					"address": map[string]interface{}{
+						"city":    "Seoul",
+						"zipCode": map[string]interface{}{"int": int32(4524)},
+					},
+					"tags": []interface{}{"official", "fast"},
+				},
+				"price": "100",
+			},
+			opts: normalizeOptions{flattenNested: true, numericFields: []string{"price"}},
+			expected: map[string]interface{}{
+				"seller.address.city":    "Seoul",
+				"seller.address.zipCode": int32(4524),
+				"seller.tags":            []interface{}{"official", "fast"},
+				"price":                  float64(100),
+			},
+		},
+		{
+			name: "nested records are kept without flattening",
+			raw: map[string]interface{}{
+				"seller": map[string]interface{}{"name": "sample-shop"},
+			},
+			expected: map[string]interface{}{
+				"seller": map[string]interface{}{"name": "sample-shop"},
+			},
+		},
+		{
+			name: "unwraps enum branches named in the schema",
+			raw: map[string]interface{}{
+				"status":     map[string]interface{}{"Status": "ACTIVE"},
+				"attributes": map[string]interface{}{"color": "red"},
+			},
+			opts: normalizeOptions{unionNames: map[string]string{"Status": "enum"}},
+			expected: map[string]interface{}{
+				"status":     "ACTIVE",
+				"attributes": map[string]interface{}{"color": "red"},
+			},
+		},
+		{
+			name: "keeps one-entry maps whose key has a dot",
+			raw: map[string]interface{}{
+				"status": map[string]interface{}{"com.example.Status": "ACTIVE"},
+				"labels": map[string]interface{}{"en.US": "Wireless earbuds"},
+				"at":     map[string]interface{}{"long.timestamp-millis": time.UnixMilli(0)},
+			},
+			opts: normalizeOptions{unionNames: map[string]string{"com.example.Status": "enum"}},
+			expected: map[string]interface{}{
+				"status": "ACTIVE",
+				"labels": map[string]interface{}{"en.US": "Wireless earbuds"},
+				"at":     "1970-01-01T00:00:00Z",
+			},
+		},
+		{
+			name: "indexes decimals as exact strings",
+			raw: map[string]interface{}{
+				"amount":   mustRat(t, "1234567890123456.78"),
+				"discount": map[string]interface{}{"bytes.decimal": big.NewRat(250, 100)},
+				"units":    big.NewRat(3, 1),
+			},
+			opts: normalizeOptions{decimalFormat: decimalString},
+			expected: map[string]interface{}{
+				"amount":   "1234567890123456.78",
+				"discount": "2.5",
+				"units":    "3",
+			},
+		},
+		{
+			name: "keeps one-entry bytes maps that are not fixed branches",
+			raw: map[string]interface{}{
+				"hash":   map[string]interface{}{"Md5": []byte{0x01, 0xff}},
+				"images": map[string]interface{}{"thumb": []byte{0xca, 0xfe}},
+			},
+			opts: normalizeOptions{bytesEncoding: bytesHex, unionNames: map[string]string{"Md5": "fixed"}},
+			expected: map[string]interface{}{
+				"hash":   "01ff",
+				"images": map[string]interface{}{"thumb": "cafe"},
+			},
+		},
+		{
+			name: "applies coercion config to unwrapped values before renames",
+			raw: map[string]interface{}{
+				"active": map[string]interface{}{"string": "false"},
+				"stock":  map[string]interface{}{"string": "7"},
+			},
+			opts: normalizeOptions{
+				coercions: map[string]string{"active": "bool", "stock": "int"},
+				renames:   map[string]string{"stock": "inventory"},
+			},
+			expected: map[string]interface{}{
+				"active":    false,
+				"inventory": int64(7),
+			},
+		},
+		{
+			name: "renames fields after coercion",
+			raw: map[string]interface{}{
+				"webcastSalesMoney": map[string]interface{}{"string": "1234.5"},
+				"productId":         "p1",
+				"title":             "title",
+			},
+			opts: normalizeOptions{renames: map[string]string{
+				"webcastSalesMoney": "sales.webcast_money",
+				"title":             "name",
+				"absent":            "ignored",
+			}},
+			expected: map[string]interface{}{
+				"sales.webcast_money": 1234.5,
+				"productId":           "p1",
+				"name":                "title",
+			},
+		},
+		{
+			name: "adds category label by productId before renaming",
+			raw: map[string]interface{}{
+				"productId": map[string]interface{}{"string": "p1"},
+			},
+			opts: normalizeOptions{
+				enrichment: &enrichmentTable{labels: map[string]string{"p1": "Beauty"}},
+				renames:    map[string]string{"productId": "id"},
+			},
+			expected: map[string]interface{}{
+				"id":            "p1",
+				"categoryLabel": "Beauty",
+			},
+		},
+		{
+			name: "leaves category label absent for unknown products",
+			raw: map[string]interface{}{
+				"productId": "p2",
+			},
+			opts: normalizeOptions{enrichment: &enrichmentTable{labels: map[string]string{"p1": "Beauty"}}},
+			expected: map[string]interface{}{
+				"productId": "p2",
+			},
+		},
+		{
+			name: "renames can swap fields",
+			raw: map[string]interface{}{
+				"a": "first",
+				"b": "second",
+			},
+			opts: normalizeOptions{renames: map[string]string{"a": "b", "b": "a"}},
+			expected: map[string]interface{}{
+				"a": "second",
+				"b": "first",
+			},
+		},
+		{
+			name: "renamed field overwrites an existing one",
+			raw: map[string]interface{}{
+				"title": "old",
+				"name":  "existing",
+			},
+			opts: normalizeOptions{renames: map[string]string{"title": "name"}},
+			expected: map[string]interface{}{
+				"name": "old",
+			},
+		},
+		{
+			name: "adds ingest metadata after renames",
+			raw: map[string]interface{}{
+				"productId": "p1",
+				"memo":      nil,
+			},
+			opts: normalizeOptions{
+				omitNulls:      true,
+				ingestMetadata: true,
+				sourceKey:      "products/2024/01.avro",
+				ingestedAt:     "2024-01-02T03:04:05Z",
+				renames:        map[string]string{"productId": "id"},
+			},
+			expected: map[string]interface{}{
+				"id":           "p1",
+				"@ingested_at": "2024-01-02T03:04:05Z",
+				"@source_key":  "products/2024/01.avro",
+			},
+		},
+		{
+			name: "oversized fields are truncated after renaming",
+			raw: map[string]interface{}{
+				"productId":   "p1",
+				"description": "abcdefghij",
+			},
+			opts: normalizeOptions{
+				maxFieldBytes:   4,
+				oversizedAction: oversizedTruncate,
+				renames:         map[string]string{"description": "desc"},
+				ingestMetadata:  true,
+				sourceKey:       "products/2024/01.avro",
+				ingestedAt:      "2024-01-02T03:04:05Z",
+			},
+			expected: map[string]interface{}{
+				"productId":    "p1",
+				"desc":         "abcd",
+				"@ingested_at": "2024-01-02T03:04:05Z",
+				"@source_key":  "products/2024/01.avro",
+			},
+		},
+		{
+			name: "plain values are untouched",
+			raw: map[string]interface{}{
+				"title": "title",
+				"tags":  []interface{}{"a", "b"},
+			},
+			expected: map[string]interface{}{
+				"title": "title",
+				"tags":  []interface{}{"a", "b"},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			opts := testCase.opts
+			if opts.numericFields == nil {
+				opts.numericFields = defaultNumericFields
+			}
+			normalized := normalizeRecord(testCase.raw, opts)
+			if !reflect.DeepEqual(normalized, testCase.expected) {
+				t.Errorf("Expected %v, but got %v", testCase.expected, normalized)
+			}
+		})
+	}
+}
+
+const testLogicalSchema = `{
+	"type": "record",
+	"name": "Product",
+	"fields": [
+		{"name": "productId", "type": "string"},
+		{"name": "updatedAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "releasedOn", "type": {"type": "int", "logicalType": "date"}},
+		{"name": "price", "type": {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}},
+		{"name": "discountedAt", "type": ["null", {"type": "long", "logicalType": "timestamp-millis"}]},
+		{"name": "discount", "type": ["null", {"type": "bytes", "logicalType": "decimal", "precision": 10, "scale": 2}]}
+	]
+}`
+
+func TestNormalizeRecordUnionBranchesFromOCF(t *testing.T) {
+	schema := `{
+		"type": "record",
+		"name": "Product",
+		"namespace": "com.example",
+		"fields": [
+			{"name": "active", "type": ["null", "boolean"]},
+			{"name": "rating", "type": ["null", "double"]},
+			{"name": "weight", "type": ["null", "float"]},
+			{"name": "thumb", "type": ["null", "bytes"]},
+			{"name": "hash", "type": ["null", {"type": "fixed", "name": "Md5", "size": 2}]},
+			{"name": "discount", "type": ["null", "double"]},
+			{"name": "images", "type": {"type": "map", "values": "bytes"}},
+			{"name": "labels", "type": {"type": "map", "values": "string"}},
+			{"name": "seller", "type": ["null", {"type": "record", "name": "Seller", "fields": [{"name": "name", "type": "string"}]}]}
+		]
+	}`
+	ocf := writeOCF(t, schema, map[string]interface{}{
+		"active":   goavro.Union("boolean", true),
+		"rating":   goavro.Union("double", 4.5),
+		"weight":   goavro.Union("float", float32(1.5)),
+		"thumb":    goavro.Union("bytes", []byte{0x01}),
+		"hash":     goavro.Union("com.example.Md5", []byte{0x01, 0xff}),
+		"discount": goavro.Union("null", nil),
+		"images":   map[string]interface{}{"thumb": []byte{0x02}},
+		"labels":   map[string]interface{}{"en.US": "Earbuds"},
+		"seller":   goavro.Union("com.example.Seller", map[string]interface{}{"name": "s1"}),
+	})
+	ocfr, err := goavro.NewOCFReader(bytes.NewReader(ocf))
+	if err != nil || !ocfr.Scan() {
+		t.Fatalf("Expected a record, but got %v", err)
+	}
+	datum, err := ocfr.Read()
+	if err != nil {
+		t.Fatalf("Expected no read error, but got %v", err)
+	}
+
+	decoder := &avroOCFDecoder{ocfr: ocfr}
+	normalized := normalizeRecord(datum.(map[string]interface{}), normalizeOptions{omitNulls: true, unionNames: decoder.unionNames()})
+	expected := map[string]interface{}{
+		"active": true,
+		"rating": 4.5,
+		"weight": float32(1.5),
+		"thumb":  "AQ==",
+		"hash":   "Af8=",
+		"images": map[string]interface{}{"thumb": "Ag=="},
+		"labels": map[string]interface{}{"en.US": "Earbuds"},
+		"seller": map[string]interface{}{"name": "s1"},
+	}
+	if !reflect.DeepEqual(normalized, expected) {
+		t.Errorf("Expected %v, but got %v", expected, normalized)
+	}
+}
+
+// mustRat은 10진수 문자열을 goavro가 decimal로 디코딩하는 *big.Rat으로 바꿉니다.
+func mustRat(t *testing.T, value string) *big.Rat {
+	t.Helper()
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		t.Fatalf("Expected a decimal, but got %q", value)
+	}
+	return r
+}
+
+func TestFieldRenamesFromEnv(t *testing.T) {
+	setenv(t, "FIELD_RENAMES", `{"webcastSalesMoney":"sales.webcast_money","price":"sales.price"}`)
+	expected := map[string]string{"webcastSalesMoney": "sales.webcast_money", "price": "sales.price"}
+	if renames := fieldRenamesFromEnv(); !reflect.DeepEqual(renames, expected) {
+		t.Errorf("Expected %v, but got %v", expected, renames)
+	}
+
+	setenv(t, "FIELD_RENAMES", `["not", "an", "object"]`)
+	if renames := fieldRenamesFromEnv(); renames != nil {
+		t.Errorf("Expected invalid FIELD_RENAMES to be ignored, but got %v", renames)
+	}
+}
+
+func TestNormalizeRecordLogicalTypes(t *testing.T) {
+	record := map[string]interface{}{
+		"productId":    "p1",
+		"updatedAt":    time.UnixMilli(1700000000123),
+		"releasedOn":   time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC),
+		"price":        big.NewRat(1990050, 100),
+		"discountedAt": goavro.Union("long.timestamp-millis", time.UnixMilli(1700000000000)),
+		"discount":     goavro.Union("bytes.decimal", big.NewRat(250, 100)),
+	}
+	ocf := writeOCF(t, testLogicalSchema, record, record)
+
+	ocfr, err := goavro.NewOCFReader(bytes.NewReader(ocf))
+	if err != nil {
+		t.Fatalf("Expected OCF reader, but got %v", err)
+	}
+	if !ocfr.Scan() {
+		t.Fatalf("Expected a record, but got none (%v)", ocfr.Err())
+	}
+	datum, err := ocfr.Read()
+	if err != nil {
+		t.Fatalf("Expected no read error, but got %v", err)
+	}
+
+	normalized := normalizeRecord(datum.(map[string]interface{}), normalizeOptions{})
+	expected := map[string]interface{}{
+		"productId":    "p1",
+		"updatedAt":    "2023-11-14T22:13:20.123Z",
+		"releasedOn":   "2024-01-02T00:00:00Z",
+		"price":        19900.5,
+		"discountedAt": "2023-11-14T22:13:20Z",
+		"discount":     2.5,
+	}
+	if !reflect.DeepEqual(normalized, expected) {
+		t.Errorf("Expected %v, but got %v", expected, normalized)
+	}
+
+	// 같은 레코드를 DECIMAL_FORMAT=string으로 정규화하면 decimal을 정확한 문자열로 넣습니다.
+	if !ocfr.Scan() {
+		t.Fatalf("Expected a second record, but got none (%v)", ocfr.Err())
+	}
+	datum, err = ocfr.Read()
+	if err != nil {
+		t.Fatalf("Expected no read error, but got %v", err)
+	}
+	normalized = normalizeRecord(datum.(map[string]interface{}), normalizeOptions{decimalFormat: decimalString})
+	if normalized["price"] != "19900.5" || normalized["discount"] != "2.5" {
+		t.Errorf("Expected exact decimal strings, but got price %v and discount %v", normalized["price"], normalized["discount"])
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// GetObject가 일시적으로 실패했을 때 다시 시도하는 기본 횟수
+const defaultS3MaxRetries = 3
+
+// getObject는 S3 객체를 가져옵니다. 스로틀링(SlowDown 등)과 5xx 오류만 백오프 후 다시 시도하고,
+// NoSuchKey나 AccessDenied 같은 오류는 바로 반환합니다.
+func (h *handler) getObject(ctx context.Context, object objectRef) (*s3.GetObjectOutput, error) {
+	return h.getObjectInput(ctx, object, object.getObjectInput())
+}
+
+// getObjectInput은 객체를 가져오는 GetObjectInput을 만듭니다.
+// 버전 관리 버킷에서는 알림을 보낸 버전을 가져오도록 VersionId를 넣습니다. (없으면 최신 버전)
+func (o objectRef) getObjectInput() *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(o.bucket),
+		Key:    aws.String(o.key),
+	}
+	if o.versionID != "" {
+		input.VersionId = aws.String(o.versionID)
+	}
+	return input
+}
+
+// getObjectInput은 input으로 GetObject를 호출하며 getObject와 같은 방식으로 재시도합니다.
+func (h *handler) getObjectInput(ctx context.Context, object objectRef, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	bucket, key := object.bucket, object.key
+	client := h.s3Client(object.region)
+	maxRetries, baseDelay := h.config.s3.maxRetries, h.config.s3.baseDelay
+
+	for attempt := 0; ; attempt++ {
+		result, err := client.GetObjectWithContext(ctx, input)
+		if err == nil || !isRetryableS3Error(err) || attempt >= maxRetries || ctx.Err() != nil {
+			return result, err
+		}
+
+		delay := backoffDelay(baseDelay, attempt)
+		logger.Warn("retrying get object", "bucket", bucket, "key", key, "attempt", attempt+1,
+			"max_retries", maxRetries, "delay", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// 본문을 읽다 연결이 끊겼을 때 이어 받는 기본 횟수와 진행 상황을 남기는 기본 간격
+const (
+	defaultS3MaxResumes  = 3
+	defaultProgressLogMB = 100
+	bytesPerMB           = 1 << 20
+)
+
+// s3Options는 GetObject를 재시도하고 본문을 이어 받는 방식을 정합니다.
+type s3Options struct {
+	// 일시적인 오류를 재시도하는 횟수와 첫 대기 시간 (S3_MAX_RETRIES, S3_RETRY_BASE_DELAY_MS)
+	maxRetries int
+	baseDelay  time.Duration
+	// 연결이 끊기면 이어 받을지 여부와 최대 횟수 (RESUME_ON_DISCONNECT, S3_MAX_RESUMES)
+	resume     bool
+	maxResumes int
+	// 진행 상황을 로그로 남기는 간격 (PROGRESS_LOG_MB)
+	progressEvery int64
+}
+
+// s3OptionsFromEnv는 환경 변수에서 S3 읽기 옵션을 읽습니다.
+func s3OptionsFromEnv() s3Options {
+	return s3Options{
+		maxRetries:    envInt("S3_MAX_RETRIES", defaultS3MaxRetries),
+		baseDelay:     envDurationMillis("S3_RETRY_BASE_DELAY_MS", defaultRetryBaseDelay),
+		resume:        envBool("RESUME_ON_DISCONNECT", false),
+		maxResumes:    envInt("S3_MAX_RESUMES", defaultS3MaxResumes),
+		progressEvery: int64(envInt("PROGRESS_LOG_MB", defaultProgressLogMB)) * bytesPerMB,
+	}
+}
+
+// resumableBody는 GetObject 본문을 읽으면서 progressEvery 바이트마다 진행 상황을 로그로 남깁니다.
+// resume이면 읽는 중 연결이 끊겼을 때 Range 요청으로 끊긴 위치부터 다시 받아 이어 붙입니다.
+type resumableBody struct {
+	ctx    context.Context
+	h      *handler
+	object objectRef
+	body   io.ReadCloser
+	// 지금까지 읽은 바이트 수 (이어 받을 Range의 시작 위치)
+	offset int64
+	// 객체 크기 (모르면 -1)
+	size int64
+	// 이어 받는 동안 객체가 바뀌었으면 다른 내용을 이어 붙이지 않도록 If-Match로 보냅니다.
+	etag          string
+	resume        bool
+	maxResumes    int
+	resumes       int
+	progressEvery int64
+	nextProgress  int64
+}
+
+// newResumableBody는 result의 본문을 핸들러의 s3Options(RESUME_ON_DISCONNECT, S3_MAX_RESUMES, PROGRESS_LOG_MB)로 감쌉니다.
+func (h *handler) newResumableBody(ctx context.Context, object objectRef, result *s3.GetObjectOutput) *resumableBody {
+	size := int64(-1)
+	if result.ContentLength != nil {
+		size = *result.ContentLength
+	}
+	progressEvery := h.config.s3.progressEvery
+	return &resumableBody{
+		ctx:           ctx,
+		h:             h,
+		object:        object,
+		body:          result.Body,
+		size:          size,
+		etag:          aws.StringValue(result.ETag),
+		resume:        h.config.s3.resume,
+		maxResumes:    h.config.s3.maxResumes,
+		progressEvery: progressEvery,
+		nextProgress:  progressEvery,
+	}
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	for {
+		n, err := b.body.Read(p)
+		b.offset += int64(n)
+		b.logProgress()
+		// 크기보다 덜 읽었는데 EOF이면 연결이 중간에 닫힌 것입니다.
+		if errors.Is(err, io.EOF) && b.size >= 0 && b.offset < b.size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || errors.Is(err, io.EOF) || !b.resumable() {
+			return n, err
+		}
+		if resumeErr := b.reopen(err); resumeErr != nil {
+			return n, fmt.Errorf("%w (resume failed: %v)", err, resumeErr)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
+
+// resumable는 끊긴 본문을 이어 받을 수 있는지 확인합니다.
+func (b *resumableBody) resumable() bool {
+	return b.resume && b.resumes < b.maxResumes && b.ctx.Err() == nil
+}
+
+// reopen은 지금까지 읽은 위치부터 본문을 다시 요청합니다.
+func (b *resumableBody) reopen(cause error) error {
+	b.resumes++
+	logger.Warn("object download interrupted, resuming", "bucket", b.object.bucket, "key", b.object.key,
+		"offset", b.offset, "size", b.size, "attempt", b.resumes, "max_resumes", b.maxResumes, "error", cause)
+	b.body.Close()
+	input := b.object.getObjectInput()
+	input.Range = aws.String(fmt.Sprintf("bytes=%d-", b.offset))
+	if b.etag != "" {
+		input.IfMatch = aws.String(b.etag)
+	}
+	result, err := b.h.getObjectInput(b.ctx, b.object, input)
+	if err != nil {
+		b.body = io.NopCloser(strings.NewReader(""))
+		return err
+	}
+	if result == nil || result.Body == nil {
+		b.body = io.NopCloser(strings.NewReader(""))
+		return errors.New("response has no body")
+	}
+	b.body = result.Body
+	return nil
+}
+
+// logProgress는 progressEvery 바이트를 읽을 때마다 진행 상황을 남깁니다.
+func (b *resumableBody) logProgress() {
+	if b.progressEvery <= 0 || b.offset < b.nextProgress {
+		return
+	}
+	for b.nextProgress <= b.offset {
+		b.nextProgress += b.progressEvery
+	}
+	args := []interface{}{"bucket", b.object.bucket, "key", b.object.key, "bytes_read", b.offset}
+	if b.size > 0 {
+		args = append(args, "size", b.size, "percent", b.offset*100/b.size)
+	}
+	logger.Info("download progress", args...)
+}
+
+// s3Client는 region의 버킷을 읽을 클라이언트를 반환합니다.
+func (h *handler) s3Client(region string) S3Getter {
+	if region == "" || h.s3Regions == nil {
+		return h.s3
+	}
+	return h.s3Regions.get(region)
+}
+
+// s3ClientCache는 리전별 S3 클라이언트를 컨테이너 수명 동안 보관합니다.
+// SNS로 여러 리전의 버킷 이벤트가 함께 들어와도 버킷마다 맞는 리전으로 요청합니다.
+type s3ClientCache struct {
+	mu      sync.Mutex
+	clients map[string]S3Getter
+	// 캐시에 없는 리전의 클라이언트를 만듭니다. 테스트에서는 가짜 구현으로 대체합니다.
+	newClient func(region string) S3Getter
+}
+
+// newS3ClientCache는 sess의 자격 증명을 공유하는 캐시를 만듭니다.
+// 함수 리전은 이미 만든 기본 클라이언트를 그대로 사용합니다.
+func newS3ClientCache(sess *session.Session, defaultRegion string, defaultClient S3Getter) *s3ClientCache {
+	return &s3ClientCache{
+		clients: map[string]S3Getter{defaultRegion: defaultClient},
+		newClient: func(region string) S3Getter {
+			return traceS3(s3.New(sess, aws.NewConfig().WithRegion(region)))
+		},
+	}
+}
+
+func (c *s3ClientCache) get(region string) S3Getter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, ok := c.clients[region]
+	if !ok {
+		logger.Debug("creating S3 client", "region", region)
+		client = c.newClient(region)
+		c.clients[region] = client
+	}
+	return client
+}
+
+// isRetryableS3Error는 다시 시도하면 성공할 수 있는 S3 오류인지 확인합니다.
+func isRetryableS3Error(err error) bool {
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.StatusCode() >= 500
+	}
+	return false
+}
+
+// 객체 본문을 읽는 기본 버퍼 크기. 기본 4KiB 버퍼는 큰 Avro 블록을 읽을 때 Read 호출이 너무 많습니다.
+const defaultReadBufferBytes = 1 << 20
+
+// gzip 파일의 처음 두 바이트
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// objectBody는 S3 객체 본문을 읽고, 닫을 때 압축 해제기와 원본 본문을 함께 닫습니다.
+type objectBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *objectBody) Close() error {
+	var firstErr error
+	for _, c := range b.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// errEmptyObject는 본문이 0바이트인 객체입니다. 읽을 레코드가 없으므로 건너뜁니다.
+var errEmptyObject = errors.New("object is empty")
+
+// openObjectBody는 S3 객체 본문을 OCF 리더에 넘길 수 있도록 엽니다.
+// 매직 바이트로 gzip 여부를 판단하며, 키 접미사(.gz)나 Content-Encoding은 참고용으로만 씁니다.
+// 본문이 없거나 0바이트이면 errEmptyObject를 반환합니다. bufferSize는 본문(과 압축 해제 결과)을 읽는 버퍼 크기입니다.
+func openObjectBody(body io.ReadCloser, key, contentEncoding string, bufferSize int) (io.ReadCloser, error) {
+	if body == nil {
+		return nil, errEmptyObject
+	}
+	br := bufio.NewReaderSize(body, bufferSize)
+	magic, err := br.Peek(len(gzipMagic))
+	if len(magic) == 0 && errors.Is(err, io.EOF) {
+		body.Close()
+		return nil, errEmptyObject
+	}
+	isGzip := len(magic) == len(gzipMagic) && magic[0] == gzipMagic[0] && magic[1] == gzipMagic[1]
+
+	hinted := strings.HasSuffix(key, ".gz") || strings.EqualFold(contentEncoding, "gzip")
+	if hinted && !isGzip {
+		logger.Warn("object looks gzip-compressed but has no gzip header, reading as-is", "key", key, "content_encoding", contentEncoding)
+	}
+	if !isGzip {
+		return &objectBody{Reader: br, closers: []io.Closer{body}}, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		body.Close()
+		return nil, fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	return &objectBody{Reader: bufio.NewReaderSize(zr, bufferSize), closers: []io.Closer{zr, body}}, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/linkedin/goavro/v2"
+)
+
+func TestGetObjectRetries(t *testing.T) {
+	setenv(t, "S3_RETRY_BASE_DELAY_MS", "1")
+
+	slowDown := awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "req-1")
+	internal := awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error.", nil), 500, "req-2")
+	accessDenied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "req-3")
+	noSuchKey := awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), 404, "req-4")
+
+	testCases := []struct {
+		name          string
+		failures      []error
+		expectedCalls int
+		expectErr     bool
+	}{
+		{name: "throttling then success", failures: []error{slowDown}, expectedCalls: 2},
+		{name: "5xx then success", failures: []error{internal, internal}, expectedCalls: 3},
+		{name: "retries exhausted", failures: []error{internal, internal, internal, internal}, expectedCalls: 4, expectErr: true},
+		{name: "access denied is not retried", failures: []error{accessDenied}, expectedCalls: 1, expectErr: true},
+		{name: "missing key is not retried", failures: []error{noSuchKey}, expectedCalls: 1, expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s3Client := &fakeS3{
+				objects:  map[string][]byte{"feed-bucket/feed.avro": []byte("data")},
+				failures: testCase.failures,
+			}
+			h := &handler{config: testConfig(t), s3: s3Client}
+
+			_, err := h.getObject(context.Background(), objectRef{bucket: "feed-bucket", key: "feed.avro"})
+			if testCase.expectErr && err == nil {
+				t.Errorf("Expected an error, but got none")
+			}
+			if !testCase.expectErr && err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			if len(s3Client.inputs) != testCase.expectedCalls {
+				t.Errorf("Expected %d calls, but got %d", testCase.expectedCalls, len(s3Client.inputs))
+			}
+		})
+	}
+}
+
+func TestGetObjectRetryHonorsContext(t *testing.T) {
+	setenv(t, "S3_RETRY_BASE_DELAY_MS", "5000")
+
+	slowDown := awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "req-1")
+	h := &handler{config: testConfig(t), s3: &fakeS3{failures: []error{slowDown, slowDown}}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := h.getObject(ctx, objectRef{bucket: "feed-bucket", key: "feed.avro"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context deadline error, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the retry wait to stop at the deadline, but took %v", elapsed)
+	}
+}
+
+func TestGetObjectUsesRegionalClient(t *testing.T) {
+	defaultClient := &fakeS3{objects: map[string][]byte{"seoul-bucket/feed.avro": []byte("data")}}
+	regional := map[string]*fakeS3{
+		"us-east-1": {objects: map[string][]byte{"virginia-bucket/feed.avro": []byte("data")}},
+	}
+	var created []string
+	h := &handler{
+		config: testConfig(t),
+		s3:     defaultClient,
+		s3Regions: &s3ClientCache{
+			clients: map[string]S3Getter{"ap-northeast-2": defaultClient},
+			newClient: func(region string) S3Getter {
+				created = append(created, region)
+				return regional[region]
+			},
+		},
+	}
+
+	objects := []objectRef{
+		{bucket: "seoul-bucket", key: "feed.avro", region: "ap-northeast-2"},
+		{bucket: "virginia-bucket", key: "feed.avro", region: "us-east-1"},
+		{bucket: "virginia-bucket", key: "feed.avro", region: "us-east-1"},
+		{bucket: "seoul-bucket", key: "feed.avro"},
+	}
+	for _, object := range objects {
+		if _, err := h.getObject(context.Background(), object); err != nil {
+			t.Errorf("Expected s3://%s/%s to be read in %q, but got %v", object.bucket, object.key, object.region, err)
+		}
+	}
+	if len(defaultClient.inputs) != 2 || len(regional["us-east-1"].inputs) != 2 {
+		t.Errorf("Expected 2 calls per region, but got %d default and %d us-east-1", len(defaultClient.inputs), len(regional["us-east-1"].inputs))
+	}
+	if len(created) != 1 || created[0] != "us-east-1" {
+		t.Errorf("Expected one cached us-east-1 client, but created %v", created)
+	}
+}
+
+func TestHandlerResumesInterruptedDownload(t *testing.T) {
+	setenv(t, "BATCH_SIZE", "1000")
+	setenv(t, "S3_RETRY_BASE_DELAY_MS", "1")
+	ocf := writeOCF(t, testProductSchema, productRecords(200)...)
+
+	testCases := []struct {
+		name      string
+		resume    string
+		expectErr bool
+	}{
+		{name: "resumes from the last offset", resume: "true"},
+		{name: "fails without resume", resume: "", expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "RESUME_ON_DISCONNECT", testCase.resume)
+			// 파일을 세 번 정도 끊어 받도록 합니다.
+			setenv(t, "S3_MAX_RESUMES", "5")
+			s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}, disconnectAfter: len(ocf)/3 + 1}
+			recorder := newBulkRecorder(t)
+
+			event := s3Event("feed-bucket", "feed.avro")
+			event.Records[0].S3.Object.VersionID = "v2"
+
+			h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, recorder.URL)}
+			summary, err := h.handle(context.Background(), event)
+			if testCase.expectErr {
+				if err == nil || !strings.Contains(err.Error(), errConnectionReset.Error()) {
+					t.Errorf("Expected a connection reset error, but got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			_, docs := recorder.documents(t)
+			if summary.RecordsRead != 200 || len(docs) != 200 {
+				t.Errorf("Expected all 200 records indexed, but got %+v", summary)
+			}
+			var ranges []string
+			for _, input := range s3Client.inputs[1:] {
+				ranges = append(ranges, aws.StringValue(input.Range))
+				if aws.StringValue(input.IfMatch) != fmt.Sprintf("\"%d\"", len(ocf)) {
+					t.Errorf("Expected If-Match with the original ETag, but got %v", input.IfMatch)
+				}
+				// 이어 받을 때도 알림을 보낸 버전을 요청합니다.
+				if aws.StringValue(input.VersionId) != "v2" {
+					t.Errorf("Expected VersionId v2 on resume, but got %v", input.VersionId)
+				}
+			}
+			step := len(ocf)/3 + 1
+			expected := []string{fmt.Sprintf("bytes=%d-", step), fmt.Sprintf("bytes=%d-", 2*step)}
+			if !reflect.DeepEqual(ranges, expected) {
+				t.Errorf("Expected range requests %v, but got %v", expected, ranges)
+			}
+		})
+	}
+}
+
+func TestResumableBodyGivesUpAfterMaxResumes(t *testing.T) {
+	setenv(t, "RESUME_ON_DISCONNECT", "true")
+	setenv(t, "S3_MAX_RESUMES", "1")
+	data := bytes.Repeat([]byte("x"), 100)
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.bin": data}, disconnectAfter: 30}
+	h := &handler{config: testConfig(t), s3: s3Client}
+	object := objectRef{bucket: "feed-bucket", key: "feed.bin"}
+	result, err := h.getObject(context.Background(), object)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	read, err := io.ReadAll(h.newResumableBody(context.Background(), object, result))
+	if !errors.Is(err, errConnectionReset) {
+		t.Errorf("Expected a connection reset error, but got %v", err)
+	}
+	if len(read) != 60 || len(s3Client.inputs) != 2 {
+		t.Errorf("Expected 60 bytes from 2 requests, but got %d bytes from %d requests", len(read), len(s3Client.inputs))
+	}
+}
+
+// countingReadCloser는 본문 Read 호출 횟수를 셉니다. 실제 S3 본문에서는 Read 호출마다 시스템 콜이 일어납니다.
+type countingReadCloser struct {
+	io.Reader
+	reads int
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	c.reads++
+	return c.Reader.Read(p)
+}
+
+func (c *countingReadCloser) Close() error { return nil }
+
+func BenchmarkDecodeReadBuffer(b *testing.B) {
+	records := make([]map[string]interface{}, 0, 20000)
+	for i := 0; i < 20000; i++ {
+		records = append(records, map[string]interface{}{
+			"productId": goavro.Union("string", fmt.Sprintf("p%d", i)),
+			"title":     "무선 블루투스 이어폰 노이즈 캔슬링",
+			"price":     goavro.Union("string", "19900"),
+			"stock":     goavro.Union("long", int64(i)),
+		})
+	}
+	var buf bytes.Buffer
+	w, err := goavro.NewOCFWriter(goavro.OCFConfig{W: &buf, Schema: testProductSchema})
+	if err != nil {
+		b.Fatalf("Expected OCF writer, but got %v", err)
+	}
+	for i := 0; i < len(records); i += 1000 {
+		block := make([]interface{}, 0, 1000)
+		for _, record := range records[i : i+1000] {
+			block = append(block, record)
+		}
+		if err := w.Append(block); err != nil {
+			b.Fatalf("Expected records to be appended, but got %v", err)
+		}
+	}
+	ocf := buf.Bytes()
+
+	for _, size := range []int{4 << 10, defaultReadBufferBytes} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(ocf)))
+			var reads int
+			for i := 0; i < b.N; i++ {
+				body := &countingReadCloser{Reader: bytes.NewReader(ocf)}
+				reader, err := openObjectBody(body, "feed.avro", "", size)
+				if err != nil {
+					b.Fatalf("Expected body, but got %v", err)
+				}
+				decoder, err := newRecordDecoder(formatAvroOCF, reader)
+				if err != nil {
+					b.Fatalf("Expected decoder, but got %v", err)
+				}
+				for decoder.Scan() {
+					if _, err := decoder.Record(); err != nil {
+						b.Fatalf("Expected record, but got %v", err)
+					}
+				}
+				reads += body.reads
+			}
+			b.ReportMetric(float64(reads)/float64(b.N), "reads/op")
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// parseBulkRPS는 BULK_RPS를 읽습니다. 값이 없거나 0이면 제한하지 않습니다.
+func parseBulkRPS(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	rps, err := strconv.ParseFloat(value, 64)
+	if err != nil || rps < 0 {
+		return 0, fmt.Errorf("invalid BULK_RPS %q (expected a non-negative number of requests per second)", value)
+	}
+	return rps, nil
+}
+
+// 같은 컨테이너의 워커와 호출이 모두 같은 제한을 나눠 쓰도록 하나만 만들어 둡니다.
+var bulkLimiters struct {
+	mu      sync.Mutex
+	rps     float64
+	limiter *rate.Limiter
+}
+
+// bulkLimiterFromEnv는 BULK_RPS에 맞는 공유 limiter를 반환합니다. 제한이 없으면 rate.Inf limiter입니다.
+// burst를 1로 두어 요청을 한꺼번에 보내지 않고 1/rps 간격으로 나눠 보냅니다.
+// 잘못된 값은 validateConfig가 시작할 때 막습니다.
+func bulkLimiterFromEnv() *rate.Limiter {
+	rps, err := parseBulkRPS(os.Getenv("BULK_RPS"))
+	if err != nil {
+		logger.Warn("bulk requests are not rate limited", "error", err)
+	}
+	bulkLimiters.mu.Lock()
+	defer bulkLimiters.mu.Unlock()
+	if bulkLimiters.limiter == nil || bulkLimiters.rps != rps {
+		limit := rate.Inf
+		if rps > 0 {
+			limit = rate.Limit(rps)
+		}
+		bulkLimiters.rps = rps
+		bulkLimiters.limiter = rate.NewLimiter(limit, 1)
+	}
+	return bulkLimiters.limiter
+}
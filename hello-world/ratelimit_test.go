@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestBulkLimiterCapsBurst(t *testing.T) {
+	setenv(t, "BULK_RPS", "50")
+	limiter := bulkLimiterFromEnv()
+	start := time.Now()
+
+	var mu sync.Mutex
+	var times []time.Duration
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Errorf("Expected no error, but got %v", err)
+			}
+			mu.Lock()
+			times = append(times, time.Since(start))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	// 50rps, burst 1이면 요청 사이가 20ms이므로 10개를 보내는 데 180ms 이상 걸립니다.
+	if times[0] > 15*time.Millisecond {
+		t.Errorf("Expected the first request immediately, but waited %v", times[0])
+	}
+	if span := times[len(times)-1]; span < 170*time.Millisecond {
+		t.Errorf("Expected 10 requests to take at least 180ms, but took %v", span)
+	}
+}
+
+func TestBulkLimiterFromEnv(t *testing.T) {
+	setenv(t, "BULK_RPS", "")
+	if limiter := bulkLimiterFromEnv(); limiter.Limit() != rate.Inf {
+		t.Errorf("Expected an unlimited limiter, but got %v", limiter.Limit())
+	}
+
+	setenv(t, "BULK_RPS", "2.5")
+	limiter := bulkLimiterFromEnv()
+	if limiter.Limit() != 2.5 || limiter.Burst() != 1 {
+		t.Errorf("Expected 2.5rps with burst 1, but got %vrps with burst %d", limiter.Limit(), limiter.Burst())
+	}
+	if again := bulkLimiterFromEnv(); again != limiter {
+		t.Errorf("Expected the same shared limiter, but got a new one")
+	}
+
+	// 차례를 기다리는 동안 ctx가 끝나면 ctx의 오류를 반환합니다.
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected the first request immediately, but got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if err := limiter.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled error, but got %v", err)
+	}
+}
+
+func TestParseBulkRPS(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  float64
+		expectErr bool
+	}{
+		{value: "", expected: 0},
+		{value: "0", expected: 0},
+		{value: "2.5", expected: 2.5},
+		{value: "-1", expectErr: true},
+		{value: "fast", expectErr: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.value, func(t *testing.T) {
+			rps, err := parseBulkRPS(testCase.value)
+			if (err != nil) != testCase.expectErr {
+				t.Fatalf("Expected error %v, but got %v", testCase.expectErr, err)
+			}
+			if rps != testCase.expected {
+				t.Errorf("Expected %v, but got %v", testCase.expected, rps)
+			}
+		})
+	}
+}
+
+func TestHandlerSharesBulkRateLimitAcrossWorkers(t *testing.T) {
+	setenv(t, "BULK_RPS", "40")
+	setenv(t, "BATCH_SIZE", "1")
+	setenv(t, "INDEX_CONCURRENCY", "4")
+
+	var mu sync.Mutex
+	var arrivals []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	s3Client := &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": writeOCF(t, testProductSchema, productRecords(6)...)}}
+	h := &handler{config: testConfig(t), s3: s3Client, openSearch: testClient(t, server.URL)}
+	if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+
+	if len(arrivals) != 6 {
+		t.Fatalf("Expected 6 bulk requests, but got %d", len(arrivals))
+	}
+	sort.Slice(arrivals, func(i, j int) bool { return arrivals[i].Before(arrivals[j]) })
+	// 워커 4개가 함께 보내도 40rps(25ms 간격)를 넘지 않아야 합니다.
+	if span := arrivals[5].Sub(arrivals[0]); span < 115*time.Millisecond {
+		t.Errorf("Expected 6 requests to be spread over at least 125ms, but took %v", span)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strconv"
+)
+
+// parseSampleRate는 SAMPLE_RATE(0~1, 예: 0.0001은 1만 건에 하나)를 읽습니다. 값이 없거나 0이면 기록하지 않습니다.
+func parseSampleRate(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("invalid SAMPLE_RATE %q (expected a fraction between 0 and 1 such as 0.0001)", value)
+	}
+	return rate, nil
+}
+
+// sampleRateFromEnv는 SAMPLE_RATE를 읽습니다. 잘못된 값은 validateConfig가 시작할 때 막습니다.
+func sampleRateFromEnv() float64 {
+	rate, err := parseSampleRate(os.Getenv("SAMPLE_RATE"))
+	if err != nil {
+		logger.Warn("indexed documents are not sampled", "error", err)
+		return 0
+	}
+	return rate
+}
+
+// sampleDocument는 rate 확률로 색인할 문서 전체를 debug 로그에 남깁니다. 운영 데이터의 필드 매핑을 확인하는 용도입니다.
+// math/rand의 전역 함수는 여러 워커가 동시에 불러도 안전하고, debug 로그가 꺼져 있으면 난수도 뽑지 않습니다.
+func sampleDocument(ctx context.Context, rate float64, index, id string, doc map[string]interface{}) {
+	if rate <= 0 || !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	if rate < 1 && rand.Float64() >= rate {
+		return
+	}
+	logger.Debug("sampled document", "index", index, "id", id, "document", doc)
+}
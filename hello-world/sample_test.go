@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestIndexBatchToOpenSearchSamplesDocuments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rate     string
+		level    slog.Level
+		expected int
+	}{
+		{name: "every document", rate: "1", level: slog.LevelDebug, expected: 3},
+		{name: "disabled", rate: "", level: slog.LevelDebug, expected: 0},
+		{name: "debug logging off", rate: "1", level: slog.LevelInfo, expected: 0},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "SAMPLE_RATE", testCase.rate)
+			var logs bytes.Buffer
+			previousLogger := logger
+			logger = slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: testCase.level}))
+			t.Cleanup(func() { logger = previousLogger })
+
+			recorder := newBulkRecorder(t)
+			if _, err := indexBatchToOpenSearch(context.Background(), sampleBatch(3), testClient(t, recorder.URL), testIndexOptions(t)); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			var sampled []map[string]interface{}
+			for _, line := range bytes.Split(logs.Bytes(), []byte("\n")) {
+				var entry map[string]interface{}
+				if json.Unmarshal(line, &entry) == nil && entry["msg"] == "sampled document" {
+					sampled = append(sampled, entry)
+				}
+			}
+			if len(sampled) != testCase.expected {
+				t.Fatalf("Expected %d sampled documents, but got %d", testCase.expected, len(sampled))
+			}
+			for _, entry := range sampled {
+				if doc, ok := entry["document"].(map[string]interface{}); !ok || doc["productId"] != entry["id"] {
+					t.Errorf("Expected the full document with its id, but got %v", entry)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSampleRate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		value     string
+		expected  float64
+		expectErr bool
+	}{
+		{name: "unset", value: "", expected: 0},
+		{name: "one in ten thousand", value: "0.0001", expected: 0.0001},
+		{name: "every document", value: "1", expected: 1},
+		{name: "negative", value: "-0.1", expectErr: true},
+		{name: "above one", value: "10000", expectErr: true},
+		{name: "not a number", value: "often", expectErr: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rate, err := parseSampleRate(testCase.value)
+			if testCase.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, but got %v", rate)
+				}
+				return
+			}
+			if err != nil || rate != testCase.expected {
+				t.Errorf("Expected %v, but got %v (%v)", testCase.expected, rate, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// newSchemaRegistryServer는 subject의 최신 버전으로 schema를 돌려주는 레지스트리를 띄웁니다.
+func newSchemaRegistryServer(t *testing.T, subject, schema string) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/subjects/"+subject+"/versions/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"subject": subject, "version": 3, "id": 42, "schema": schema})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestSchemaRegistryCachesSchema(t *testing.T) {
+	server, requests := newSchemaRegistryServer(t, "products-value", testProductSchema)
+	registry := &schemaRegistry{client: server.Client(), baseURL: server.URL, subject: "products-value", ttl: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		schema, err := registry.readerSchema(context.Background())
+		if err != nil {
+			t.Fatalf("Expected reader schema, but got %v", err)
+		}
+		if schema.id != 42 || schema.version != 3 || len(schema.fields) != 4 {
+			t.Errorf("Expected schema 42 version 3 with 4 fields, but got %+v", schema)
+		}
+	}
+	if n := atomic.LoadInt32(requests); n != 1 {
+		t.Errorf("Expected 1 registry request, but got %d", n)
+	}
+
+	// ttl이 지나 다시 가져오지 못하면 이전 스키마를 씁니다.
+	registry.fetchedAt = time.Now().Add(-time.Hour)
+	registry.subject = "missing-value"
+	if schema, err := registry.readerSchema(context.Background()); err != nil || schema.id != 42 {
+		t.Errorf("Expected the cached schema, but got %v, %v", schema, err)
+	}
+}
+
+func TestSchemaRegistryMissingSubject(t *testing.T) {
+	server, _ := newSchemaRegistryServer(t, "products-value", testProductSchema)
+	registry := &schemaRegistry{client: server.Client(), baseURL: server.URL, subject: "orders-value", ttl: time.Minute}
+	_, err := registry.readerSchema(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a 404 error, but got %v", err)
+	}
+}
+
+func TestReaderSchemaCheckCompatible(t *testing.T) {
+	reader := `{
+		"type": "record",
+		"name": "com.example.Product",
+		"fields": [
+			{"name": "productId", "type": ["null", "string"]},
+			{"name": "title", "type": "string"},
+			{"name": "stock", "type": ["null", "long"]},
+			{"name": "rating", "type": "double", "default": 0},
+			{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["ACTIVE", "DELETED"]}},
+			{"name": "tags", "type": {"type": "array", "items": "string"}, "default": []}
+		]
+	}`
+	schema, err := parseReaderSchema(reader, 1, 1)
+	if err != nil {
+		t.Fatalf("Expected valid reader schema, but got %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		writer   string
+		expected string
+	}{
+		{
+			name:   "same fields with promotion and defaults",
+			writer: `{"type":"record","name":"Product","fields":[{"name":"productId","type":"string"},{"name":"title","type":"string"},{"name":"stock","type":["null","int"]},{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE"]}},{"name":"extra","type":"string"}]}`,
+		},
+		{
+			name:     "missing field without default",
+			writer:   `{"type":"record","name":"Product","fields":[{"name":"productId","type":"string"},{"name":"stock","type":"long"},{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE"]}}]}`,
+			expected: "title: field is missing from the writer schema and has no default",
+		},
+		{
+			name:     "narrowing type",
+			writer:   `{"type":"record","name":"Product","fields":[{"name":"productId","type":"string"},{"name":"title","type":"string"},{"name":"stock","type":"double"},{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE"]}}]}`,
+			expected: "stock: double does not match any branch of union",
+		},
+		{
+			name:     "nullable writer for required reader field",
+			writer:   `{"type":"record","name":"Product","fields":[{"name":"productId","type":"string"},{"name":"title","type":["null","string"]},{"name":"stock","type":"long"},{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE"]}}]}`,
+			expected: "title: cannot read null as string",
+		},
+		{
+			name:     "unknown enum symbol",
+			writer:   `{"type":"record","name":"Product","fields":[{"name":"productId","type":"string"},{"name":"title","type":"string"},{"name":"stock","type":"long"},{"name":"status","type":{"type":"enum","name":"Status","symbols":["ACTIVE","ARCHIVED"]}}]}`,
+			expected: `status: enum symbol "ARCHIVED" is not in the reader schema`,
+		},
+		{
+			name:     "different record name",
+			writer:   `{"type":"record","name":"Order","fields":[]}`,
+			expected: "record com.example.Product does not match Order",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := schema.checkCompatible(testCase.writer)
+			if testCase.expected == "" {
+				if err != nil {
+					t.Errorf("Expected compatible schemas, but got %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
+
+func TestHandlerChecksSchemaRegistry(t *testing.T) {
+	// writer 스키마(testProductSchema)에 없는 필드를 기본값과 함께 추가하고 stock은 뺀 reader 스키마
+	compatible := `{"type":"record","name":"Product","fields":[
+		{"name":"productId","type":["null","string"]},
+		{"name":"title","type":"string"},
+		{"name":"price","type":["null","string"]},
+		{"name":"currency","type":"string","default":"KRW"}
+	]}`
+	incompatible := `{"type":"record","name":"Product","fields":[
+		{"name":"productId","type":["null","string"]},
+		{"name":"brand","type":"string"}
+	]}`
+	ocf := writeOCF(t, testProductSchema, map[string]interface{}{
+		"productId": goavro.Union("string", "p1"),
+		"title":     "충전기",
+		"price":     goavro.Union("string", "9900"),
+		"stock":     goavro.Union("long", int64(3)),
+	})
+
+	t.Run("compatible", func(t *testing.T) {
+		server, _ := newSchemaRegistryServer(t, "products-value", compatible)
+		recorder := newBulkRecorder(t)
+		h := &handler{
+			config:     testConfig(t),
+			s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+			openSearch: testClient(t, recorder.URL),
+			schemas:    &schemaRegistry{client: server.Client(), baseURL: server.URL, subject: "products-value", ttl: time.Minute},
+		}
+		if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		_, docs := recorder.documents(t)
+		if len(docs) != 1 || docs[0]["currency"] != "KRW" || docs[0]["title"] != "충전기" {
+			t.Fatalf("Expected the document shaped by the reader schema, but got %v", docs)
+		}
+		if _, ok := docs[0]["stock"]; ok {
+			t.Errorf("Expected stock to be dropped as it is not in the reader schema, but got %v", docs[0])
+		}
+	})
+
+	t.Run("aliased field", func(t *testing.T) {
+		// title을 name으로 바꾸고 이전 이름을 aliases로 남긴 reader 스키마
+		renamed := `{"type":"record","name":"Product","fields":[
+			{"name":"productId","type":["null","string"]},
+			{"name":"name","type":"string","aliases":["title"]}
+		]}`
+		server, _ := newSchemaRegistryServer(t, "products-value", renamed)
+		recorder := newBulkRecorder(t)
+		h := &handler{
+			config:     testConfig(t),
+			s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+			openSearch: testClient(t, recorder.URL),
+			schemas:    &schemaRegistry{client: server.Client(), baseURL: server.URL, subject: "products-value", ttl: time.Minute},
+		}
+		if _, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro")); err != nil {
+			t.Fatalf("Expected no error, but got %v", err)
+		}
+		_, docs := recorder.documents(t)
+		if len(docs) != 1 || docs[0]["name"] != "충전기" {
+			t.Fatalf("Expected title to be read as name, but got %v", docs)
+		}
+		if _, ok := docs[0]["title"]; ok {
+			t.Errorf("Expected the writer field name to be dropped, but got %v", docs[0])
+		}
+	})
+
+	t.Run("incompatible", func(t *testing.T) {
+		server, _ := newSchemaRegistryServer(t, "products-value", incompatible)
+		recorder := newBulkRecorder(t)
+		h := &handler{
+			config:     testConfig(t),
+			s3:         &fakeS3{objects: map[string][]byte{"feed-bucket/feed.avro": ocf}},
+			openSearch: testClient(t, recorder.URL),
+			schemas:    &schemaRegistry{client: server.Client(), baseURL: server.URL, subject: "products-value", ttl: time.Minute},
+		}
+		_, err := h.handle(context.Background(), s3Event("feed-bucket", "feed.avro"))
+		if err == nil || !strings.Contains(err.Error(), "s3://feed-bucket/feed.avro is incompatible with schema products-value version 3: brand") {
+			t.Errorf("Expected an incompatible schema error, but got %v", err)
+		}
+		if len(recorder.requests) != 0 {
+			t.Errorf("Expected no bulk requests, but got %d", len(recorder.requests))
+		}
+	})
+}
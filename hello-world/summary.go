@@ -0,0 +1,155 @@
+package main
+
+// summaryVersion은 InvocationSummary 형식의 버전입니다.
+// 필드를 추가하는 것은 호환되지만, 이름을 바꾸거나 의미를 바꿀 때는 버전을 올립니다.
+const summaryVersion = 1
+
+// InvocationSummary는 HandleRequest가 반환하는 처리 결과 요약입니다.
+// Step Functions 등에서 JSON으로 읽어 부분 실패 여부에 따라 분기할 수 있습니다.
+type InvocationSummary struct {
+	Version          int `json:"version"`
+	RecordsRead      int `json:"recordsRead"`
+	DocumentsIndexed int `json:"documentsIndexed"`
+	DocumentsFailed  int `json:"documentsFailed"`
+	// SKIP_EXISTING 사용 시 이미 같은 내용이라 쓰지 않은 문서 수 (documentsIndexed에 포함하지 않음)
+	DocumentsNoop  int `json:"documentsNoop,omitempty"`
+	RecordsSkipped int `json:"recordsSkipped"`
+	// 읽지 못해 건너뛴 레코드 수
+	RecordErrors int `json:"recordErrors"`
+	// VALIDATION_CONFIG 규칙을 어겨 색인하지 않은 레코드 수
+	RecordsInvalid int `json:"recordsInvalid"`
+	BatchesSent    int `json:"batchesSent"`
+	// 이유별로 건너뛴 레코드 수 (recordsSkipped와 recordsInvalid의 내역)
+	SkipReasons map[string]int `json:"skipReasons,omitempty"`
+	// "bucket/key"별 결과
+	Files map[string]*FileSummary `json:"files"`
+}
+
+// FileSummary는 S3 객체 하나의 처리 결과입니다.
+type FileSummary struct {
+	RecordsRead      int `json:"recordsRead"`
+	DocumentsIndexed int `json:"documentsIndexed"`
+	DocumentsFailed  int `json:"documentsFailed"`
+	DocumentsNoop    int `json:"documentsNoop,omitempty"`
+	RecordsSkipped   int `json:"recordsSkipped"`
+	RecordErrors     int `json:"recordErrors"`
+	RecordsInvalid   int `json:"recordsInvalid"`
+	BatchesSent      int `json:"batchesSent"`
+	// 이유별로 건너뛴 레코드 수
+	SkipReasons map[string]int `json:"skipReasons,omitempty"`
+	// 파일 중간에 더 읽을 수 없게 되어 앞부분만 색인된 경우
+	Partial bool `json:"partial,omitempty"`
+	// 파일을 읽거나 색인하는 중 발생한 오류 (없으면 생략)
+	Error string `json:"error,omitempty"`
+}
+
+func fileSummaryKey(bucket, key string) string {
+	// 직접 호출로 받은 레코드처럼 버킷이 없으면 키만 씁니다.
+	if bucket == "" {
+		return key
+	}
+	return bucket + "/" + key
+}
+
+// file은 파일별 요약을 반환합니다. 호출하는 쪽에서 m.mu를 잡고 있어야 합니다.
+func (m *invocationMetrics) file(bucket, key string) *FileSummary {
+	if m.files == nil {
+		m.files = make(map[string]*FileSummary)
+	}
+	name := fileSummaryKey(bucket, key)
+	if m.files[name] == nil {
+		m.files[name] = &FileSummary{}
+	}
+	return m.files[name]
+}
+
+// fileRead는 파일 하나에서 읽은 레코드 수와 건너뛴 잘못된 레코드 수를 기록합니다.
+func (m *invocationMetrics) fileRead(bucket, key string, records, recordErrors int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recordsRead += records
+	m.recordErrors += recordErrors
+	file := m.file(bucket, key)
+	file.RecordsRead += records
+	file.RecordErrors += recordErrors
+}
+
+// fileInvalid는 파일 하나에서 검증 규칙을 어겨 색인하지 않은 레코드 수를 기록합니다.
+func (m *invocationMetrics) fileInvalid(bucket, key string, records int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recordsInvalid += records
+	file := m.file(bucket, key)
+	file.RecordsInvalid += records
+	m.skipped(file, skipValidation, records)
+}
+
+// skipped는 이유별로 건너뛴 레코드 수를 호출 전체와 파일에 더합니다. 호출하는 쪽에서 m.mu를 잡고 있어야 합니다.
+func (m *invocationMetrics) skipped(file *FileSummary, reason string, records int) {
+	if m.skipReasons == nil {
+		m.skipReasons = make(map[string]int)
+	}
+	if file.SkipReasons == nil {
+		file.SkipReasons = make(map[string]int)
+	}
+	m.skipReasons[reason] += records
+	file.SkipReasons[reason] += records
+}
+
+// filePartial은 파일이 중간에 읽기를 멈춰 일부만 색인되었음을 표시합니다.
+func (m *invocationMetrics) filePartial(bucket, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.file(bucket, key).Partial = true
+}
+
+// fileFailed는 파일에 발생한 오류를 요약에 남깁니다. nil은 무시합니다.
+func (m *invocationMetrics) fileFailed(bucket, key string, err error) {
+	if err == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	summary := m.file(bucket, key)
+	if summary.Error != "" {
+		summary.Error += "; "
+	}
+	summary.Error += err.Error()
+}
+
+// summary는 지금까지 모은 결과로 InvocationSummary를 만듭니다.
+func (m *invocationMetrics) summary() InvocationSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := make(map[string]*FileSummary, len(m.files))
+	for name, file := range m.files {
+		copied := *file
+		copied.SkipReasons = copyCounts(file.SkipReasons)
+		files[name] = &copied
+	}
+	return InvocationSummary{
+		Version:          summaryVersion,
+		RecordsRead:      m.recordsRead,
+		DocumentsIndexed: m.documentsIndexed,
+		DocumentsFailed:  m.documentsFailed,
+		DocumentsNoop:    m.documentsNoop,
+		RecordsSkipped:   m.documentsSkipped,
+		RecordErrors:     m.recordErrors,
+		RecordsInvalid:   m.recordsInvalid,
+		SkipReasons:      copyCounts(m.skipReasons),
+		BatchesSent:      m.batchesFlushed,
+		Files:            files,
+	}
+}
+
+// copyCounts는 summary가 반환한 뒤에도 지표가 바뀌지 않도록 map을 복사합니다.
+func copyCounts(counts map[string]int) map[string]int {
+	if counts == nil {
+		return nil
+	}
+	copied := make(map[string]int, len(counts))
+	for k, v := range counts {
+		copied[k] = v
+	}
+	return copied
+}
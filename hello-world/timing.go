@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"time"
+)
+
+// fileTimings는 파일 하나의 단계별 소요 시간입니다. 어느 단계가 느린지 구분하기 위해 씁니다.
+type fileTimings struct {
+	// GetObject와 본문을 읽는 데 걸린 시간
+	download time.Duration
+	// 레코드 디코딩과 변환에 걸린 시간 (다운로드와 워커를 기다린 시간 제외)
+	decode time.Duration
+	// 워커가 이 파일의 배치를 색인한 시간의 합 (배치가 동시에 색인되면 실제 경과 시간보다 클 수 있음)
+	index time.Duration
+	// 내려받은 본문 크기 (압축된 경우 압축된 크기)
+	bytes   int64
+	records int
+}
+
+// timedReader는 Read에 걸린 시간과 읽은 바이트 수를 누적합니다.
+// 본문은 디코딩하면서 스트리밍으로 읽으므로 다운로드 시간을 이렇게 따로 잽니다.
+type timedReader struct {
+	io.ReadCloser
+	elapsed time.Duration
+	bytes   int64
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.ReadCloser.Read(p)
+	r.elapsed += time.Since(start)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// timings는 파일별 소요 시간을 반환합니다. 호출하는 쪽에서 m.mu를 잡고 있어야 합니다.
+func (m *invocationMetrics) timings(bucket, key string) *fileTimings {
+	if m.fileTimings == nil {
+		m.fileTimings = make(map[string]*fileTimings)
+	}
+	name := fileSummaryKey(bucket, key)
+	if m.fileTimings[name] == nil {
+		m.fileTimings[name] = &fileTimings{}
+	}
+	return m.fileTimings[name]
+}
+
+// fileDecoded는 파일 하나를 내려받고 디코딩하는 데 걸린 시간을 기록합니다.
+func (m *invocationMetrics) fileDecoded(bucket, key string, download, decode time.Duration, bytes int64, records int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := m.timings(bucket, key)
+	t.download += download
+	t.decode += decode
+	t.bytes += bytes
+	t.records += records
+	m.downloadDuration += download
+	m.decodeDuration += decode
+}
+
+// batchIndexed는 배치 하나를 색인하는 데 걸린 시간을 기록합니다.
+func (m *invocationMetrics) batchIndexed(bucket, key string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timings(bucket, key).index += duration
+	m.indexDuration += duration
+}
+
+// logFileTimings는 파일마다 단계별 소요 시간과 처리량을 로그로 남깁니다. 모든 배치가 끝난 뒤 호출합니다.
+func (m *invocationMetrics) logFileTimings() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.fileTimings))
+	for name := range m.fileTimings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := m.fileTimings[name]
+		total := t.download + t.decode + t.index
+		var recordsPerSecond float64
+		if total > 0 {
+			recordsPerSecond = float64(t.records) / total.Seconds()
+		}
+		logger.Info("file timings", "file", name, "records", t.records, "bytes", t.bytes,
+			"download_ms", t.download.Milliseconds(), "decode_ms", t.decode.Milliseconds(), "index_ms", t.index.Milliseconds(),
+			"records_per_second", recordsPerSecond)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// validationRules는 VALIDATION_CONFIG로 지정한 레코드 검증 규칙입니다.
+//
+//	{"required":["productId","title"],"ranges":{"price":{"min":0},"stock":{"min":0,"max":100000}}}
+type validationRules struct {
+	// 값이 있어야 하는 필드. null과 빈 문자열은 없는 것으로 봅니다.
+	Required []string `json:"required"`
+	// 숫자 필드의 허용 범위 (경계 포함). 값이 없는 필드는 검사하지 않습니다.
+	Ranges map[string]numericRange `json:"ranges"`
+}
+
+// numericRange는 숫자 필드의 최솟값과 최댓값입니다. 생략한 쪽은 검사하지 않습니다.
+type numericRange struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// parseValidationRules는 VALIDATION_CONFIG를 읽습니다. 값이 없으면 nil을 반환합니다.
+func parseValidationRules(value string) (*validationRules, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var rules validationRules
+	decoder := json.NewDecoder(strings.NewReader(value))
+	// 오타가 난 규칙 이름이 조용히 무시되지 않도록 합니다.
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("invalid VALIDATION_CONFIG: %w", err)
+	}
+	for field, r := range rules.Ranges {
+		if r.Min == nil && r.Max == nil {
+			return nil, fmt.Errorf("invalid VALIDATION_CONFIG: range for %q needs min or max", field)
+		}
+		if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+			return nil, fmt.Errorf("invalid VALIDATION_CONFIG: range for %q has min %v greater than max %v", field, *r.Min, *r.Max)
+		}
+	}
+	return &rules, nil
+}
+
+// validationRulesFromEnv는 VALIDATION_CONFIG를 읽습니다. 잘못된 설정은 validateConfig가 시작할 때 막으므로
+// 여기서는 경고만 남기고 검증하지 않습니다.
+func validationRulesFromEnv() *validationRules {
+	rules, err := parseValidationRules(os.Getenv("VALIDATION_CONFIG"))
+	if err != nil {
+		logger.Warn("records are not validated", "error", err)
+		return nil
+	}
+	return rules
+}
+
+// validate는 doc이 규칙을 어긴 이유를 모두 모아 반환합니다. 규칙이 없거나 통과하면 nil입니다.
+func (r *validationRules) validate(doc map[string]interface{}) error {
+	if r == nil {
+		return nil
+	}
+	var errs []error
+	for _, field := range r.Required {
+		if value, ok := doc[field]; !ok || value == nil || value == "" {
+			errs = append(errs, fmt.Errorf("required field %q is missing", field))
+		}
+	}
+	// 오류 순서가 실행마다 바뀌지 않도록 필드 이름 순으로 검사합니다.
+	fields := make([]string, 0, len(r.Ranges))
+	for field := range r.Ranges {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		value, ok := doc[field]
+		if !ok || value == nil {
+			continue
+		}
+		n, ok := numericValue(value)
+		if !ok {
+			errs = append(errs, fmt.Errorf("field %q is not a number: %v", field, value))
+			continue
+		}
+		limits := r.Ranges[field]
+		if limits.Min != nil && n < *limits.Min {
+			errs = append(errs, fmt.Errorf("field %q is %v, below the minimum %v", field, n, *limits.Min))
+		}
+		if limits.Max != nil && n > *limits.Max {
+			errs = append(errs, fmt.Errorf("field %q is %v, above the maximum %v", field, n, *limits.Max))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// numericValue는 디코딩된 숫자 값(또는 숫자 문자열)을 float64로 바꿉니다.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
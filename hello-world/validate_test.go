@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidationRules(t *testing.T) {
+	rules, err := parseValidationRules(`{"required":["productId","title"],"ranges":{"price":{"min":0},"stock":{"min":0,"max":1000}}}`)
+	if err != nil {
+		t.Fatalf("Expected valid rules, but got %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		doc      map[string]interface{}
+		expected []string
+	}{
+		{name: "valid", doc: map[string]interface{}{"productId": "p1", "title": "충전기", "price": 9900.5, "stock": int64(3)}},
+		{name: "missing ranged fields are not checked", doc: map[string]interface{}{"productId": "p1", "title": "충전기", "price": nil}},
+		{name: "missing required field", doc: map[string]interface{}{"title": "충전기"}, expected: []string{`required field "productId" is missing`}},
+		{name: "empty required field", doc: map[string]interface{}{"productId": "", "title": nil}, expected: []string{`"productId" is missing`, `"title" is missing`}},
+		{name: "below minimum", doc: map[string]interface{}{"productId": "p1", "title": "충전기", "price": -1.0}, expected: []string{`field "price" is -1, below the minimum 0`}},
+		{name: "above maximum", doc: map[string]interface{}{"productId": "p1", "title": "충전기", "stock": int64(1001)}, expected: []string{`field "stock" is 1001, above the maximum 1000`}},
+		{name: "numeric string", doc: map[string]interface{}{"productId": "p1", "title": "충전기", "price": "-5"}, expected: []string{`below the minimum`}},
+		{name: "not a number", doc: map[string]interface{}{"productId": "p1", "title": "충전기", "price": "N/A"}, expected: []string{`field "price" is not a number`}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := rules.validate(testCase.doc)
+			if len(testCase.expected) == 0 {
+				if err != nil {
+					t.Errorf("Expected no error, but got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected errors %v, but got nil", testCase.expected)
+			}
+			for _, expected := range testCase.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error containing %q, but got %v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseValidationRulesErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{name: "invalid JSON", value: `{"required":`, expected: "invalid VALIDATION_CONFIG"},
+		{name: "unknown rule", value: `{"requires":["productId"]}`, expected: `unknown field "requires"`},
+		{name: "empty range", value: `{"ranges":{"price":{}}}`, expected: `range for "price" needs min or max`},
+		{name: "inverted range", value: `{"ranges":{"price":{"min":10,"max":1}}}`, expected: "greater than max"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseValidationRules(testCase.value)
+			if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+				t.Errorf("Expected error containing %q, but got %v", testCase.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+// ENABLE_XRAY를 켜면 AWS X-Ray SDK로 S3 요청과 OpenSearch 요청을 호출 세그먼트 아래 subsegment로 남깁니다.
+// SDK는 aws-lambda-go가 호출 ctx에 넣는 추적 헤더(x-amzn-trace-id)로 부모 세그먼트를 찾으므로
+// HandleRequest의 ctx를 요청까지 그대로 넘기면 됩니다.
+
+func xrayEnabled() bool {
+	return envBool("ENABLE_XRAY", false)
+}
+
+// traceS3는 ENABLE_XRAY가 켜져 있으면 client의 요청을 xray.AWS로 추적합니다.
+func traceS3(client *s3.S3) *s3.S3 {
+	if xrayEnabled() {
+		xray.AWS(client.Client)
+	}
+	return client
+}
+
+// traceTransport는 ENABLE_XRAY가 켜져 있으면 OpenSearch 요청을 xray.RoundTripper로 추적합니다.
+func traceTransport(next http.RoundTripper) http.RoundTripper {
+	if !xrayEnabled() {
+		return next
+	}
+	return xray.RoundTripper(next)
+}
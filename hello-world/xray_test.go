@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-xray-sdk-go/xray"
+)
+
+const testTraceHeader = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+
+// xrayRecorder는 데몬 대신 SDK가 내보내는 세그먼트를 모읍니다.
+type xrayRecorder struct {
+	mu       sync.Mutex
+	segments []map[string]interface{}
+}
+
+func (r *xrayRecorder) Emit(seg *xray.Segment) {
+	encoded, err := json.Marshal(seg)
+	if err != nil {
+		return
+	}
+	var segment map[string]interface{}
+	json.Unmarshal(encoded, &segment)
+	r.mu.Lock()
+	r.segments = append(r.segments, segment)
+	r.mu.Unlock()
+}
+
+func (r *xrayRecorder) RefreshEmitterWithAddress(*net.UDPAddr) {}
+
+// recordXRay는 SDK의 emitter를 xrayRecorder로 바꾸고 테스트가 끝나면 기본 emitter로 되돌립니다.
+func recordXRay(t *testing.T) *xrayRecorder {
+	t.Helper()
+	recorder := &xrayRecorder{}
+	if err := xray.Configure(xray.Config{Emitter: recorder}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		emitter, err := xray.NewDefaultEmitter(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2000})
+		if err == nil {
+			xray.Configure(xray.Config{Emitter: emitter})
+		}
+	})
+	return recorder
+}
+
+// testS3Client는 server를 S3 엔드포인트로 쓰는 실제 SDK 클라이언트를 만듭니다.
+func testS3Client(t *testing.T, server *httptest.Server) *s3.S3 {
+	t.Helper()
+	sess, err := session.NewSession(aws.NewConfig().
+		WithRegion("ap-northeast-2").
+		WithEndpoint(server.URL).
+		WithS3ForcePathStyle(true).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3.New(sess)
+}
+
+func TestHandleRequestSendsXRaySubsegments(t *testing.T) {
+	testCases := []struct {
+		name    string
+		enabled string
+		header  string
+		traced  bool
+	}{
+		{name: "enabled and sampled", enabled: "true", header: testTraceHeader, traced: true},
+		{name: "not sampled", enabled: "true", header: "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=0"},
+		{name: "disabled", enabled: "", header: testTraceHeader},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			setenv(t, "ENABLE_XRAY", testCase.enabled)
+			emitted := recordXRay(t)
+			ocf := writeOCF(t, testProductSchema, productRecords(2)...)
+			s3Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(ocf)
+			}))
+			defer s3Server.Close()
+			recorder := newBulkRecorder(t)
+			sharedHandlerMu.Lock()
+			sharedHandler = &handler{
+				config:     testConfig(t),
+				s3:         traceS3(testS3Client(t, s3Server)),
+				openSearch: testClient(t, recorder.URL),
+			}
+			sharedHandlerMu.Unlock()
+			t.Cleanup(func() {
+				sharedHandlerMu.Lock()
+				sharedHandler = nil
+				sharedHandlerMu.Unlock()
+			})
+
+			payload, err := json.Marshal(s3Event("feed-bucket", "products.avro"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.WithValue(context.Background(), xray.LambdaTraceHeaderKey, testCase.header)
+			if _, err := HandleRequest(ctx, payload); err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+
+			emitted.mu.Lock()
+			defer emitted.mu.Unlock()
+			if !testCase.traced {
+				if len(emitted.segments) != 0 {
+					t.Errorf("Expected no subsegments, but got %v", emitted.segments)
+				}
+				return
+			}
+			names := map[string]map[string]interface{}{}
+			for _, segment := range emitted.segments {
+				if segment["trace_id"] != "1-5759e988-bd862e3fe1be46a994272793" || segment["parent_id"] != "53995c3f42cd8ad8" {
+					t.Errorf("Expected a subsegment of the invocation trace, but got %v", segment)
+				}
+				names[segment["name"].(string)] = segment
+			}
+			if aws, _ := names["s3"]["aws"].(map[string]interface{}); aws["operation"] != "GetObject" || aws["bucket_name"] != "feed-bucket" || aws["key"] != "products.avro" {
+				t.Errorf("Expected an S3 GetObject subsegment for feed-bucket/products.avro, but got %v", names["s3"])
+			}
+			bulk, ok := names[strings.TrimPrefix(recorder.URL, "http://")]
+			if !ok || bulk["namespace"] != "remote" {
+				t.Fatalf("Expected a remote subsegment for the bulk request, but got %v", emitted.segments)
+			}
+			if request := bulk["http"].(map[string]interface{})["request"].(map[string]interface{}); request["method"] != "POST" {
+				t.Errorf("Expected a POST bulk request, but got %v", request)
+			}
+		})
+	}
+}